@@ -0,0 +1,63 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"slices"
+
+	"github.com/go-kit/log/level"
+)
+
+// asmSpaceContext is the context of the built-in ASM disk group space metrics. They are only added when it is in
+// the collector include list, as the default asm_diskgroup metrics already cover the basics.
+const asmSpaceContext = "asm_diskgroup_space"
+
+// asmSpaceSourceFile is the source file of the built-in ASM disk group space metrics
+const asmSpaceSourceFile = "ASM disk groups (built in)"
+
+// asmSpaceMetric returns the built-in metric with the total, free and usable space of each ASM disk group.
+// v$asm_diskgroup_stat is used rather than v$asm_diskgroup, as it does not make ASM discover new disks.
+func asmSpaceMetric() Metric {
+	return Metric{
+		Context: asmSpaceContext,
+		Labels:  []string{"diskgroup"},
+		MetricsDesc: map[string]string{
+			"total_mb":       "Total size of the ASM disk group in MB, from the v$asm_diskgroup_stat view in Oracle.",
+			"free_mb":        "Unused space in the ASM disk group in MB, from the v$asm_diskgroup_stat view in Oracle.",
+			"usable_file_mb": "Space that can be safely used for files in the ASM disk group in MB, allowing for mirroring, from the v$asm_diskgroup_stat view in Oracle.",
+		},
+		Request:          "select name diskgroup, total_mb, free_mb, usable_file_mb from v$asm_diskgroup_stat",
+		IgnoreZeroResult: true,
+	}
+}
+
+// withASMSpaceMetrics adds the built-in ASM disk group space metrics to the default metrics when they are included
+func (e *Exporter) withASMSpaceMetrics(metrics Metrics) Metrics {
+	if !slices.Contains(e.config.IncludeCollectors, asmSpaceContext) {
+		return metrics
+	}
+	metric := asmSpaceMetric()
+	metric.SourceFile = asmSpaceSourceFile
+	metrics.Metric = append(metrics.Metric, metric)
+	return metrics
+}
+
+// probeASMAccess returns true if the user can query v$asm_diskgroup_stat. It is only checked when the built-in
+// ASM disk group space metrics are included.
+func (e *Exporter) probeASMAccess() bool {
+	if !slices.Contains(e.config.IncludeCollectors, asmSpaceContext) {
+		return false
+	}
+	var count int
+	if err := e.db.QueryRow("select count(*) from v$asm_diskgroup_stat where rownum = 1").Scan(&count); err != nil {
+		level.Info(e.logger).Log("msg", "Skipping the ASM disk group space metrics, v$asm_diskgroup_stat cannot be queried", "error", err)
+		return false
+	}
+	return true
+}
+
+// matchesASMAccess returns false for the built-in ASM disk group space metrics if the user cannot query them
+func (e *Exporter) matchesASMAccess(metric Metric) bool {
+	return metric.SourceFile != asmSpaceSourceFile || e.asmAccess
+}
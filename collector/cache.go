@@ -0,0 +1,146 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cachedMetric holds the results of the last scrape of a metric with a cache TTL
+type cachedMetric struct {
+	metrics []prometheus.Metric
+	scraped time.Time
+}
+
+func (e *Exporter) getCacheTTL(metric Metric) (time.Duration, bool) {
+	if len(metric.CacheTTL) > 0 {
+		ttl, err := time.ParseDuration(metric.CacheTTL)
+		if err != nil {
+			level.Error(e.logger).Log("msg", "Unable to convert cachettl to duration (metric="+metric.Context+")")
+			return 0, false
+		}
+		return ttl, ttl > 0
+	}
+	return 0, false
+}
+
+// scrapeCachedMetric sends the cached results of a metric if they are younger than the TTL.
+// Otherwise the metric is scraped, and the results are cached if the scrape succeeded.
+func (e *Exporter) scrapeCachedMetric(ctx context.Context, db Querier, ch chan<- prometheus.Metric, m Metric, ttl time.Duration) error {
+	e.cacheMu.Lock()
+	cached, ok := e.metricCache[metricKey(m)]
+	e.cacheMu.Unlock()
+	if ok && time.Since(cached.scraped) < ttl {
+		e.sendCachedMetric(m, cached, ch)
+		return nil
+	}
+	return e.scrapeAndCacheMetric(ctx, db, ch, m)
+}
+
+// scrapeSampledMetric scrapes a metric on the first scrape and then on every SampleEvery-th scrape, and sends the
+// cached results of its last scrape on the others. Until a scrape has succeeded, it is scraped every time.
+func (e *Exporter) scrapeSampledMetric(ctx context.Context, db Querier, ch chan<- prometheus.Metric, m Metric) error {
+	e.cacheMu.Lock()
+	cached, ok := e.metricCache[metricKey(m)]
+	e.cacheMu.Unlock()
+	if ok && (e.scrapeCount-1)%m.SampleEvery != 0 {
+		e.sendCachedMetric(m, cached, ch)
+		return nil
+	}
+	return e.scrapeAndCacheMetric(ctx, db, ch, m)
+}
+
+// sendCachedMetric sends the cached results of a metric and sets their age
+func (e *Exporter) sendCachedMetric(m Metric, cached cachedMetric, ch chan<- prometheus.Metric) {
+	level.Debug(e.logger).Log("msg", "Using cached results", "Context", m.Context, "age", time.Since(cached.scraped))
+	e.cacheAge.WithLabelValues(m.Context).Set(time.Since(cached.scraped).Seconds())
+	for _, metric := range cached.metrics {
+		ch <- metric
+	}
+}
+
+// scrapeAndCacheMetric scrapes a metric, and caches the results if the scrape succeeded
+func (e *Exporter) scrapeAndCacheMetric(ctx context.Context, db Querier, ch chan<- prometheus.Metric, m Metric) error {
+	results := cachedMetric{scraped: time.Now()}
+	cacheCh := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range cacheCh {
+			results.metrics = append(results.metrics, metric)
+			ch <- metric
+		}
+	}()
+	err := e.scrapeMetric(ctx, db, cacheCh, m)
+	close(cacheCh)
+	<-done
+	if err != nil {
+		return err
+	}
+
+	e.cacheMu.Lock()
+	e.metricCache[metricKey(m)] = results
+	e.cacheMu.Unlock()
+	e.cacheAge.WithLabelValues(m.Context).Set(0)
+	return nil
+}
+
+// scrapeWithLastValue runs the scrape of a metric and remembers the results. If the scrape fails, the last
+// successfully scraped results are sent instead, so that the metric doesn't disappear during an outage.
+// The results are only sent once the scrape has finished, so that partial results are not mixed with the last values.
+func (e *Exporter) scrapeWithLastValue(m Metric, ch chan<- prometheus.Metric, scrape func(chan<- prometheus.Metric) error) error {
+	results := cachedMetric{scraped: time.Now()}
+	resultCh := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range resultCh {
+			results.metrics = append(results.metrics, metric)
+		}
+	}()
+	err := scrape(resultCh)
+	close(resultCh)
+	<-done
+
+	if err != nil && e.sendLastValue(m, ch) {
+		return err
+	}
+	for _, metric := range results.metrics {
+		ch <- metric
+	}
+	if err == nil {
+		e.cacheMu.Lock()
+		e.lastValues[metricKey(m)] = results
+		e.cacheMu.Unlock()
+		e.lastValueAge.WithLabelValues(m.Context).Set(0)
+	}
+	return err
+}
+
+// sendLastValues sends the last successfully scraped results of every metric, used when the database is down
+func (e *Exporter) sendLastValues(ch chan<- prometheus.Metric) {
+	for _, m := range e.metricsToScrape.Metric {
+		e.sendLastValue(m, ch)
+	}
+}
+
+// sendLastValue sends the last successfully scraped results of a metric, if there are any, and sets their age
+func (e *Exporter) sendLastValue(m Metric, ch chan<- prometheus.Metric) bool {
+	e.cacheMu.Lock()
+	last, ok := e.lastValues[metricKey(m)]
+	e.cacheMu.Unlock()
+	if !ok {
+		return false
+	}
+	level.Debug(e.logger).Log("msg", "Using last scraped values", "Context", m.Context, "age", time.Since(last.scraped))
+	e.lastValueAge.WithLabelValues(m.Context).Set(time.Since(last.scraped).Seconds())
+	for _, metric := range last.metrics {
+		ch <- metric
+	}
+	return true
+}
@@ -6,23 +6,31 @@ package collector
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/godror/godror"
+	"github.com/godror/godror/dsn"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -31,48 +39,196 @@ type Exporter struct {
 	config          *Config
 	mu              *sync.Mutex
 	metricsToScrape Metrics
-	scrapeInterval  *time.Duration
-	user            string
-	password        string
-	connectString   string
-	configDir       string
-	externalAuth    bool
-	duration, error prometheus.Gauge
-	totalScrapes    prometheus.Counter
-	scrapeErrors    *prometheus.CounterVec
-	scrapeResults   []prometheus.Metric
-	up              prometheus.Gauge
-	dbtype          int
-	dbtypeGauge     prometheus.Gauge
-	db              *sql.DB
-	logger          log.Logger
-	lastTick        *time.Time
+	hashMap         map[string][]byte
+	unmappedValues  sync.Map
+	impreciseValues sync.Map
+	missingColumns  sync.Map
+	deltaMu         sync.Mutex
+	previousValues  map[string]float64
+	counterOffsets  map[string]counterOffset
+	cacheMu         sync.Mutex
+	metricCache     map[string]cachedMetric
+	lastValues      map[string]cachedMetric
+	lastValueAge    *prometheus.GaugeVec
+	lastScrapeTimes map[string]time.Time
+	slowQueryLogged map[string]time.Time
+	cacheAge        *prometheus.GaugeVec
+	// scrapeInterval is the interval of the scheduled scrapes, nil or 0 unless RunScheduledScrapes is running
+	scrapeInterval atomic.Pointer[time.Duration]
+	user           string
+	// sessionUser is the user the session is connected as, which is not known in advance with token or external authentication
+	sessionUser      string
+	password         string
+	passwordHash     []byte
+	connectString    string
+	configDir        string
+	externalAuth     bool
+	externalDB       bool
+	duration, error  prometheus.Gauge
+	lastScrapeTime   prometheus.Gauge
+	totalScrapes     prometheus.Counter
+	reconnects       prometheus.Counter
+	pushErrors       prometheus.Counter
+	skippedScrapes   prometheus.Counter
+	scrapeGoroutines *concurrencyGauge
+	scrapeQueue      *concurrencyGauge
+	reloadTime       prometheus.Gauge
+	reloadSuccess    prometheus.Gauge
+	scrapeErrors     *prometheus.CounterVec
+	queryTimeouts    *prometheus.CounterVec
+	scrapeDuration   *prometheus.HistogramVec
+	collectorSuccess *prometheus.GaugeVec
+	scrapeRows       *prometheus.GaugeVec
+	resultsMu        sync.RWMutex
+	scrapeResults    []prometheus.Metric
+	up               prometheus.Gauge
+	dbtype           int
+	namespace        string
+	serviceName      string
+	instanceName     string
+	// target is the name of the database in a MultiExporter, used to group the metrics pushed to the Pushgateway
+	target           string
+	databaseRole     string
+	dbVersion        string
+	dbtypeGauge      prometheus.Gauge
+	instanceInfo     *prometheus.GaugeVec
+	collectorInfo    *prometheus.GaugeVec
+	metricsFileValid *prometheus.GaugeVec
+	timeDriftDesc    *prometheus.Desc
+	// dbMu guards db for the readers that don't hold mu, db is only replaced while holding both
+	dbMu     sync.RWMutex
+	db       *sql.DB
+	logger   log.Logger
+	lastTick *time.Time
+	// scrapeCount is the number of scrapes so far, used to scrape metrics with a sampleevery on every Nth scrape only
+	scrapeCount int
+	// primedResults are the results of the warmup scrape, served once by the first Collect, guarded by mu
+	primedResults []prometheus.Metric
+	primedAt      time.Time
+	// asmAccess is true if the built-in ASM disk group space metrics can be scraped
+	asmAccess      bool
+	redactPatterns []*regexp.Regexp
+	// intervalCh passes a new scrape interval from SetScrapeInterval to the RunScheduledScrapes loop
+	intervalCh chan time.Duration
+	// reconnectFailures and nextReconnect are the backoff state of reconnectWithBackoff, guarded by mu
+	reconnectFailures int
+	nextReconnect     time.Time
 }
 
 // Config is the configuration of the exporter
 type Config struct {
-	User               string
-	Password           string
-	ConnectString      string
-	DbRole             string
-	ConfigDir          string
-	ExternalAuth       bool
-	MaxIdleConns       int
-	MaxOpenConns       int
+	User                  string
+	ProxyUser             string
+	Password              string
+	PasswordFile          string
+	SecretProvider        SecretProvider
+	TokenProvider         TokenProvider
+	Tracer                Tracer
+	ConnectString         string
+	DbRole                string
+	ConfigDir             string
+	WalletLocation        string
+	ExternalAuth          bool
+	MaxIdleConns          int
+	MaxOpenConns          int
+	ConnMaxLifetime       time.Duration
+	ConnMaxIdleTime       time.Duration
+	ConnectionWaitTimeout time.Duration
+	MaxConcurrentScrapes  int
+	// LogFormat is logfmt or json. It selects the format of the logger NewExporter creates when it is passed a nil
+	// logger; a caller that passes its own logger configures its format itself, and sets LogFormat to match it,
+	// so that maps, e.g. metricsdesc, are logged as JSON objects in JSON logs
+	LogFormat         string
+	MetricsNamespace  string
+	ConstLabels       map[string]string
+	IncludeCollectors []string
+	ExcludeCollectors []string
+	SessionInitSQL    []string
+	PushgatewayURL    string
+	// PushgatewayJob is the job name the metrics are pushed to the Pushgateway under, oracledb_exporter if empty
+	PushgatewayJob     string
 	CustomMetrics      string
 	QueryTimeout       int
 	DefaultMetricsFile string
+	HealthCheckQuery   string
+	CheckTNSAlias      bool
+	MaxRows            int
+	// EmitLastValueOnFailure returns the last successfully scraped results of a metric when its scrape fails or
+	// the database is down, rather than dropping the metric until the database is back
+	EmitLastValueOnFailure bool
+	WebAuthUser            string
+	WebAuthPasswordFile    string
+	WebBearerTokenFile     string
+	CollectorInfo          bool
+	InitialWindow          time.Duration
+	ReconnectMaxRetries    int
+	ReconnectBackoff       time.Duration
+	ScrapeDurationBuckets  []float64
+	// WaitEventMetrics adds the built-in wait_event metrics, with the WaitEventLimit events with the most time waited
+	WaitEventMetrics bool
+	WaitEventLimit   int
+	// SetModuleAction sets the module of the session to oracledb_exporter and its action to the metric context
+	// for each query, so that the load of each metric can be told apart in v$session, ASH and AWR
+	SetModuleAction bool
+	// SlowQueryThreshold logs a warning when a metric's query takes longer, at most once an hour per metric,
+	// with the query's execution plan if CapturePlans is set. Zero disables it.
+	SlowQueryThreshold time.Duration
+	CapturePlans       bool
+	// WarmupScrape runs one scrape in the background when the exporter is created, and serves its results
+	// to the first Collect if they are recent, so that it doesn't pay the latency of a full scrape.
+	// It is not needed with RunScheduledScrapes, which scrapes straight away.
+	WarmupScrape bool
+	// RedactPatterns are regular expressions matching text that is replaced with *** in the SQL and bind values
+	// that are logged, e.g. a password in a comment of a request
+	RedactPatterns []string
+	// TopSQLMetrics adds the built-in top_sql_rank metrics, with the TopSQLLimit statements with the most elapsed time
+	TopSQLMetrics bool
+	TopSQLLimit   int
+}
+
+// SecretProvider supplies the database password, e.g. from a secrets manager.
+// It is asked for the password every time the exporter connects, so a rotated password is used without a restart.
+//
+// To use your own provider when using the collector as a library, set it in the Config:
+//
+//	type envPassword struct{}
+//
+//	func (envPassword) GetPassword(ctx context.Context) (string, error) {
+//		return os.Getenv("MY_DB_PASSWORD"), nil
+//	}
+//
+//	cfg := collector.CreateDefaultConfig()
+//	cfg.SecretProvider = envPassword{}
+type SecretProvider interface {
+	GetPassword(ctx context.Context) (string, error)
+}
+
+// TokenProvider supplies a database access token and the private key it was issued for, e.g. an OCI IAM
+// database token to connect to an Autonomous Database as an IAM user without a password or wallet.
+// When it is set in the Config, the exporter connects with the token rather than a user and password,
+// and asks for a new token whenever the token of the connection pool expires.
+type TokenProvider interface {
+	GetToken(ctx context.Context) (token, privateKey string, err error)
 }
 
 // CreateDefaultConfig returns the default configuration of the Exporter
 // it is to be of note that the DNS will be empty when
 func CreateDefaultConfig() *Config {
 	return &Config{
-		MaxIdleConns:       0,
-		MaxOpenConns:       10,
-		CustomMetrics:      "",
-		QueryTimeout:       5,
-		DefaultMetricsFile: "",
+		MaxIdleConns:         0,
+		MaxOpenConns:         10,
+		MaxConcurrentScrapes: 10,
+		MetricsNamespace:     "oracledb",
+		HealthCheckQuery:     "select 1 from dual",
+		CustomMetrics:        "",
+		QueryTimeout:         5,
+		MaxRows:              10000,
+		InitialWindow:        time.Hour,
+		WaitEventLimit:       20,
+		TopSQLLimit:          10,
+		DefaultMetricsFile:   "",
+		ReconnectMaxRetries:  3,
+		ReconnectBackoff:     time.Second,
 	}
 }
 
@@ -83,11 +239,43 @@ type Metric struct {
 	MetricsDesc      map[string]string
 	MetricsType      map[string]string
 	MetricsBuckets   map[string]map[string]string
+	BucketScheme     string
+	BucketStart      float64
+	BucketFactor     float64
+	BucketWidth      float64
+	BucketCount      int
+	MetricsQuantiles map[string]map[string]string
+	ValueMap         map[string]map[string]float64
+	Delta            []string
+	Monotonic        []string
 	FieldToAppend    string
 	Request          string
+	RequestFallback  []string
+	PLSQL            bool
+	Bindings         map[string]string
 	IgnoreZeroResult bool
+	EmitZeroRows     bool
+	NullValue        string
 	QueryTimeout     string
 	ScrapeInterval   string
+	CacheTTL         string
+	Timezone         string
+	DateFormat       string
+	TrueValues       []string
+	DatabaseRole     string
+	MinDBVersion     string
+	MaxDBVersion     string
+	FlagImprecise    bool
+	MaxRows          int
+	Container        string
+	InitialWindow    string
+	SampleEvery      int
+	Round            *int
+	Aggregate        string
+	Priority         int
+	Streaming        bool
+	// SourceFile is the file the metric was loaded from, set when it is loaded
+	SourceFile string `toml:"-" yaml:"-"`
 }
 
 // Metrics is a container structure for prometheus metrics
@@ -96,21 +284,20 @@ type Metrics struct {
 }
 
 var (
-	additionalMetrics Metrics
-	hashMap           = make(map[int][]byte)
-	namespace         = "oracledb"
-	exporterName      = "exporter"
+	namespace    = "oracledb"
+	exporterName = "exporter"
 )
 
 // ScrapResult is container structure for error handling
 type ScrapeResult struct {
 	Err         error
+	Kind        ErrorKind
 	Metric      Metric
 	ScrapeStart time.Time
 }
 
 func maskDsn(dsn string) string {
-	parts := strings.Split(dsn, "@")
+	parts := strings.SplitN(dsn, "@", 2)
 	if len(parts) > 1 {
 		maskedURL := "***@" + parts[1]
 		return maskedURL
@@ -118,55 +305,263 @@ func maskDsn(dsn string) string {
 	return dsn
 }
 
-// NewExporter creates a new Exporter instance
+// NewExporter creates a new Exporter instance. If logger is nil, the exporter logs to stderr
+// in the format given by cfg.LogFormat, otherwise cfg.LogFormat should match the format of logger.
+//
+// If the configuration is invalid, e.g. a const label or redact pattern, it returns a nil Exporter and the error.
+// If only connecting to the database fails, it returns the Exporter as well as the error: the Exporter can be
+// registered, and reports the database as down until it reconnects on a later scrape.
 func NewExporter(logger log.Logger, cfg *Config) (*Exporter, error) {
+	e, err := newExporter(logger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PasswordFile != "" {
+		e.checkIfPasswordChanged()
+	}
+	err = e.connect()
+	if err == nil && cfg.WarmupScrape {
+		go e.warmup()
+	}
+	return e, err
+}
+
+// NewExporterWithDB creates a new Exporter instance that scrapes an existing connection pool, e.g. one
+// wrapped with your own tracing, instead of connecting to the database itself. The connection settings
+// in cfg are not used, and the exporter never closes or replaces db, so it does not reconnect if db is closed.
+func NewExporterWithDB(logger log.Logger, cfg *Config, db *sql.DB) (*Exporter, error) {
+	e, err := newExporter(logger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	e.externalDB = true
+	e.db = db
+	e.probe()
+	return e, nil
+}
+
+// newExporter creates an Exporter with its metrics loaded, which is not yet connected to the database
+func newExporter(logger log.Logger, cfg *Config) (*Exporter, error) {
+	if logger == nil {
+		logger = newLogger(cfg.LogFormat)
+	}
+	if cfg.ReconnectMaxRetries < 0 || cfg.ReconnectMaxRetries > maxReconnectRetries {
+		return nil, fmt.Errorf("the reconnect max retries must be between 0 and %d, got %d", maxReconnectRetries, cfg.ReconnectMaxRetries)
+	}
+	if cfg.ReconnectBackoff < 0 {
+		return nil, fmt.Errorf("the reconnect backoff cannot be negative, got %s", cfg.ReconnectBackoff)
+	}
+	metricsNamespace := cfg.MetricsNamespace
+	if metricsNamespace == "" {
+		metricsNamespace = namespace
+	}
+	scrapeDurationBuckets := cfg.ScrapeDurationBuckets
+	if len(scrapeDurationBuckets) == 0 {
+		scrapeDurationBuckets = prometheus.DefBuckets
+	}
 	e := &Exporter{
-		mu:            &sync.Mutex{},
-		user:          cfg.User,
-		password:      cfg.Password,
-		connectString: cfg.ConnectString,
-		configDir:     cfg.ConfigDir,
-		externalAuth:  cfg.ExternalAuth,
+		mu:              &sync.Mutex{},
+		hashMap:         make(map[string][]byte),
+		metricCache:     make(map[string]cachedMetric),
+		lastValues:      make(map[string]cachedMetric),
+		lastScrapeTimes: make(map[string]time.Time),
+		slowQueryLogged: make(map[string]time.Time),
+		previousValues:  make(map[string]float64),
+		counterOffsets:  make(map[string]counterOffset),
+		intervalCh:      make(chan time.Duration, 1),
+		user:            cfg.User,
+		password:        cfg.Password,
+		connectString:   cfg.ConnectString,
+		configDir:       cfg.ConfigDir,
+		externalAuth:    cfg.ExternalAuth,
 		duration: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: exporterName,
-			Name:      "last_scrape_duration_seconds",
-			Help:      "Duration of the last scrape of metrics from Oracle DB.",
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "last_scrape_duration_seconds",
+			Help:        "Duration of the last scrape of metrics from Oracle DB.",
+			ConstLabels: cfg.ConstLabels,
+		}),
+		lastScrapeTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "last_scrape_timestamp_seconds",
+			Help:        "Unix time of the last scrape of metrics from Oracle DB.",
+			ConstLabels: cfg.ConstLabels,
 		}),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: namespace,
-			Subsystem: exporterName,
-			Name:      "scrapes_total",
-			Help:      "Total number of times Oracle DB was scraped for metrics.",
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "scrapes_total",
+			Help:        "Total number of times Oracle DB was scraped for metrics.",
+			ConstLabels: cfg.ConstLabels,
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "reconnects_total",
+			Help:        "Total number of attempts made to reconnect to Oracle DB.",
+			ConstLabels: cfg.ConstLabels,
+		}),
+		scrapeGoroutines: newConcurrencyGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "active_scrape_goroutines",
+			Help:        "Number of metrics being scraped, running their query or waiting for a free query slot.",
+			ConstLabels: cfg.ConstLabels,
+		}),
+		scrapeQueue: newConcurrencyGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "scrape_queue_depth",
+			Help:        "Number of metrics waiting for a free query slot, limited by scrape.maxConcurrent.",
+			ConstLabels: cfg.ConstLabels,
+		}),
+		skippedScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "scrapes_skipped_total",
+			Help:        "Total number of scheduled scrapes skipped because the previous scrape was still running.",
+			ConstLabels: cfg.ConstLabels,
+		}),
+		reloadTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "config_last_reload_timestamp_seconds",
+			Help:        "Time of the last successful load of the metrics definitions, in seconds since the epoch.",
+			ConstLabels: cfg.ConstLabels,
+		}),
+		reloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "config_reload_success",
+			Help:        "Whether the last reload of the metrics definitions succeeded (1 for success, 0 for failure).",
+			ConstLabels: cfg.ConstLabels,
+		}),
+		pushErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "push_errors_total",
+			Help:        "Total number of times pushing metrics to the Pushgateway failed.",
+			ConstLabels: cfg.ConstLabels,
 		}),
 		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Namespace: namespace,
-			Subsystem: exporterName,
-			Name:      "scrape_errors_total",
-			Help:      "Total number of times an error occured scraping a Oracle database.",
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "scrape_errors_total",
+			Help:        "Total number of times an error occured scraping a Oracle database, by the kind of error.",
+			ConstLabels: cfg.ConstLabels,
+		}, []string{"collector", "kind"}),
+		queryTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "query_timeouts_total",
+			Help:        "Total number of times a metric's query did not finish within its query timeout.",
+			ConstLabels: cfg.ConstLabels,
+		}, []string{"collector"}),
+		scrapeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "scrape_duration_seconds",
+			Help:        "Duration of the queries run to scrape each metric from Oracle DB.",
+			ConstLabels: cfg.ConstLabels,
+			Buckets:     scrapeDurationBuckets,
+		}, []string{"collector"}),
+		collectorSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "collector_success",
+			Help:        "Whether the last scrape of each metric from Oracle DB succeeded (1 for success, 0 for error).",
+			ConstLabels: cfg.ConstLabels,
+		}, []string{"collector"}),
+		scrapeRows: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "scrape_rows",
+			Help:        "Number of rows returned by the query of each metric on its last scrape.",
+			ConstLabels: cfg.ConstLabels,
+		}, []string{"collector"}),
+		cacheAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "cache_age_seconds",
+			Help:        "Age of the cached results returned for each metric with a cachettl.",
+			ConstLabels: cfg.ConstLabels,
+		}, []string{"collector"}),
+		lastValueAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "last_value_age_seconds",
+			Help:        "Age of the results returned for each metric, which is more than zero when the last values are returned because the scrape failed.",
+			ConstLabels: cfg.ConstLabels,
 		}, []string{"collector"}),
 		error: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: exporterName,
-			Name:      "last_scrape_error",
-			Help:      "Whether the last scrape of metrics from Oracle DB resulted in an error (1 for error, 0 for success).",
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "last_scrape_error",
+			Help:        "Whether the last scrape of metrics from Oracle DB resulted in an error (1 for error, 0 for success).",
+			ConstLabels: cfg.ConstLabels,
 		}),
 		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "up",
-			Help:      "Whether the Oracle database server is up.",
+			Namespace:   metricsNamespace,
+			Name:        "up",
+			Help:        "Whether the Oracle database server is up.",
+			ConstLabels: cfg.ConstLabels,
 		}),
 		dbtypeGauge: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "dbtype",
-			Help:      "Type of database the exporter is connected to (0=non-CDB, 1=CDB, >1=PDB).",
+			Namespace:   metricsNamespace,
+			Name:        "dbtype",
+			Help:        "Type of database the exporter is connected to (0=non-CDB, 1=CDB, >1=PDB, -1=unknown).",
+			ConstLabels: cfg.ConstLabels,
 		}),
-		logger: logger,
-		config: cfg,
+		instanceInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "instance_info",
+			Help:        "Version and instance details of the database the exporter is connected to, always 1.",
+			ConstLabels: cfg.ConstLabels,
+		}, []string{"version", "instance_name", "host_name"}),
+		collectorInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "collector_info",
+			Help:        "The metrics file each collector (metric context) was loaded from, always 1.",
+			ConstLabels: cfg.ConstLabels,
+		}, []string{"collector", "file"}),
+		metricsFileValid: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   exporterName,
+			Name:        "metrics_file_valid",
+			Help:        "Whether the custom metrics file was loaded on the last reload (1 if it was, 0 if it was skipped because of an error).",
+			ConstLabels: cfg.ConstLabels,
+		}, []string{"file"}),
+		timeDriftDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "time_drift_seconds"),
+			"Difference between the database's SYSTIMESTAMP and the exporter host's clock, positive if the database is ahead.",
+			nil, cfg.ConstLabels),
+		namespace: metricsNamespace,
+		logger:    logger,
+		config:    cfg,
+	}
+	for _, pattern := range cfg.RedactPatterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		e.redactPatterns = append(e.redactPatterns, re)
 	}
 	e.metricsToScrape = e.DefaultMetrics()
-	err := e.connect()
-	return e, err
+	e.metricsToScrape.Metric, _ = filterCollectors(e.metricsToScrape.Metric, cfg.IncludeCollectors, cfg.ExcludeCollectors)
+	normalizeMetrics(e.metricsToScrape.Metric)
+	e.generateBuckets(e.metricsToScrape.Metric)
+	if err := checkConstLabels(e.metricsToScrape.Metric, cfg.ConstLabels); err != nil {
+		return nil, err
+	}
+	e.setCollectorInfo()
+	e.reloadSuccess.Set(1)
+	e.reloadTime.SetToCurrentTime()
+	return e, nil
 }
 
 // Describe describes all the metrics exported by the Oracle DB exporter.
@@ -192,43 +587,82 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 		close(doneCh)
 	}()
 
-	e.Collect(metricCh)
+	// the warmup results, if any, are described rather than scraping again, and kept for the first Collect
+	e.collect(metricCh, false)
 	close(metricCh)
 	<-doneCh
 }
 
 // Collect implements prometheus.Collector.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.collect(ch, true)
+}
+
+// collect sends the results of a scrape, or of a scheduled scrape, to ch. The results of the warmup scrape are
+// sent instead of scraping, if they are recent and have not been served yet, and consumePrimed marks them as served.
+func (e *Exporter) collect(ch chan<- prometheus.Metric, consumePrimed bool) {
 	// they are running scheduled scrapes we should only scrape new data
 	// on the interval
-	if e.scrapeInterval != nil && *e.scrapeInterval != 0 {
-		// read access must be checked
-		e.mu.Lock()
-		for _, r := range e.scrapeResults {
+	if e.scheduled() {
+		// the results are replaced as a whole once a scheduled scrape is complete, never appended to
+		e.resultsMu.RLock()
+		results := e.scrapeResults
+		e.resultsMu.RUnlock()
+		for _, r := range results {
 			ch <- r
 		}
-		e.mu.Unlock()
 		return
 	}
 
 	// otherwise do a normal scrape per request
 	e.mu.Lock() // ensure no simultaneous scrapes
 	defer e.mu.Unlock()
-	e.scrape(ch, nil)
+	scrapeTime := time.Now()
+	if e.primedResults != nil && time.Since(e.primedAt) < primedResultsMaxAge {
+		for _, r := range e.primedResults {
+			ch <- r
+		}
+		scrapeTime = e.primedAt
+		if consumePrimed {
+			e.primedResults = nil
+		}
+	} else {
+		e.scrape(context.Background(), ch, nil)
+	}
+	e.lastScrapeTime.Set(float64(scrapeTime.UnixNano()) / 1e9)
 	ch <- e.duration
+	ch <- e.lastScrapeTime
 	ch <- e.totalScrapes
+	ch <- e.reconnects
+	ch <- e.pushErrors
+	ch <- e.skippedScrapes
+	e.scrapeGoroutines.collect(ch)
+	e.scrapeQueue.collect(ch)
+	ch <- e.reloadTime
+	ch <- e.reloadSuccess
 	ch <- e.error
 	e.scrapeErrors.Collect(ch)
+	e.queryTimeouts.Collect(ch)
+	e.scrapeDuration.Collect(ch)
+	e.collectorSuccess.Collect(ch)
+	e.scrapeRows.Collect(ch)
+	e.cacheAge.Collect(ch)
+	e.lastValueAge.Collect(ch)
 	ch <- e.up
 	ch <- e.dbtypeGauge
+	e.instanceInfo.Collect(ch)
+	if e.config.CollectorInfo {
+		e.collectorInfo.Collect(ch)
+	}
+	e.metricsFileValid.Collect(ch)
 }
 
 // RunScheduledScrapes is only relevant for users of this package that want to set the scrape on a timer
 // rather than letting it be per Collect call
 func (e *Exporter) RunScheduledScrapes(ctx context.Context, si time.Duration) {
-	e.scrapeInterval = &si
+	e.scrapeInterval.Store(&si)
 
-	e.doScrape(time.Now())
+	e.doScrape(ctx, time.Now())
 
 	ticker := time.NewTicker(si)
 	defer ticker.Stop()
@@ -236,55 +670,157 @@ func (e *Exporter) RunScheduledScrapes(ctx context.Context, si time.Duration) {
 	for {
 		select {
 		case tick := <-ticker.C:
-
-			e.doScrape(tick)
+			// scraped in the background, so that a scrape that hangs doesn't hold up the ticker
+			go e.doScrape(ctx, tick)
+		case si := <-e.intervalCh:
+			ticker.Reset(si)
+			level.Info(e.logger).Log("msg", "Scrape interval changed", "interval", si)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (e *Exporter) doScrape(tick time.Time) {
-	e.mu.Lock() // ensure no simultaneous scrapes
-	e.scheduledScrape(&tick)
+// SetScrapeInterval changes the interval of the scheduled scrapes while RunScheduledScrapes is running.
+// It waits for any scrape in progress to finish, and the next scrape is then one new interval later.
+func (e *Exporter) SetScrapeInterval(si time.Duration) error {
+	if si <= 0 {
+		return errors.New("the scrape interval must be more than 0")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.scheduled() {
+		return errors.New("scheduled scrapes are not running")
+	}
+	e.scrapeInterval.Store(&si)
+	sendInterval(e.intervalCh, si)
+	return nil
+}
+
+// scheduled returns true if RunScheduledScrapes is running
+func (e *Exporter) scheduled() bool {
+	si := e.scrapeInterval.Load()
+	return si != nil && *si != 0
+}
+
+// sendInterval passes a new scrape interval to a RunScheduledScrapes loop, replacing one it has not picked up yet
+func sendInterval(ch chan time.Duration, si time.Duration) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- si
+}
+
+// doScrape runs a scheduled scrape, unless the previous scrape is still running, e.g. because the database has stalled.
+// Skipping the tick rather than waiting for the lock stops goroutines and connections piling up behind a hung scrape.
+func (e *Exporter) doScrape(ctx context.Context, tick time.Time) {
+	if !e.mu.TryLock() { // ensure no simultaneous scrapes
+		e.skippedScrapes.Inc()
+		level.Warn(e.logger).Log("msg", "Skipping scheduled scrape, the previous scrape is still running",
+			"database", maskDsn(e.connectString),
+			"tick", tick)
+		return
+	}
+	e.scheduledScrape(ctx, &tick)
 	e.lastTick = &tick
 	e.mu.Unlock()
+
+	// pushed once the lock is released, as the push collects the results of the scrape
+	if e.config.PushgatewayURL != "" {
+		e.push()
+	}
 }
 
-func (e *Exporter) scheduledScrape(tick *time.Time) {
+// primedResultsMaxAge is how long the results of the warmup scrape can be served for, before the first Collect
+// scrapes instead
+const primedResultsMaxAge = time.Minute
+
+// warmup runs one scrape in the background, so that the first Collect can serve its results rather than wait
+// for a full scrape. It holds mu like any other scrape, so a Collect that arrives meanwhile waits for it and
+// is then served the results.
+func (e *Exporter) warmup() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.scheduled() {
+		// scheduled scrapes have started, and scrape straight away
+		return
+	}
+	start := time.Now()
 	metricCh := make(chan prometheus.Metric, 5)
+	results := []prometheus.Metric{}
+	done := make(chan struct{})
+	go func() {
+		for m := range metricCh {
+			results = append(results, m)
+		}
+		close(done)
+	}()
+	e.scrape(context.Background(), metricCh, nil)
+	close(metricCh)
+	<-done
+	e.primedResults = results
+	e.primedAt = time.Now()
+	level.Info(e.logger).Log("msg", "Warmup scrape done",
+		"database", maskDsn(e.connectString),
+		"duration", time.Since(start))
+}
 
+func (e *Exporter) scheduledScrape(ctx context.Context, tick *time.Time) {
+	metricCh := make(chan prometheus.Metric, 5)
+
+	// the results are collected into a local slice, so that Collect never sees a partial scrape
+	results := []prometheus.Metric{}
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		e.scrapeResults = []prometheus.Metric{}
-		for {
-			scrapeResult, more := <-metricCh
-			if more {
-				e.scrapeResults = append(e.scrapeResults, scrapeResult)
-				continue
-			}
-			return
+		for scrapeResult := range metricCh {
+			results = append(results, scrapeResult)
 		}
 	}()
-	e.scrape(metricCh, tick)
+	e.scrape(ctx, metricCh, tick)
 
 	// report metadata metrics
+	e.lastScrapeTime.Set(float64(tick.UnixNano()) / 1e9)
 	metricCh <- e.duration
+	metricCh <- e.lastScrapeTime
 	metricCh <- e.totalScrapes
+	metricCh <- e.reconnects
+	metricCh <- e.pushErrors
+	metricCh <- e.skippedScrapes
+	e.scrapeGoroutines.collect(metricCh)
+	e.scrapeQueue.collect(metricCh)
+	metricCh <- e.reloadTime
+	metricCh <- e.reloadSuccess
 	metricCh <- e.error
 	e.scrapeErrors.Collect(metricCh)
+	e.queryTimeouts.Collect(metricCh)
+	e.scrapeDuration.Collect(metricCh)
+	e.collectorSuccess.Collect(metricCh)
+	e.scrapeRows.Collect(metricCh)
+	e.cacheAge.Collect(metricCh)
+	e.lastValueAge.Collect(metricCh)
 	metricCh <- e.up
+	e.instanceInfo.Collect(metricCh)
+	if e.config.CollectorInfo {
+		e.collectorInfo.Collect(metricCh)
+	}
+	e.metricsFileValid.Collect(metricCh)
 	close(metricCh)
 	wg.Wait()
+
+	e.resultsMu.Lock()
+	e.scrapeResults = results
+	e.resultsMu.Unlock()
 }
 
-func (e *Exporter) scrape(ch chan<- prometheus.Metric, tick *time.Time) {
+func (e *Exporter) scrape(ctx context.Context, ch chan<- prometheus.Metric, tick *time.Time) {
 	e.totalScrapes.Inc()
+	e.scrapeCount++
 	var err error
-	var scrapemutex sync.Mutex
-	errChan := make(chan ScrapeResult, len(e.metricsToScrape.Metric))
+	// created once the metrics are (re)loaded, so that every metric has room for its result
+	var errChan chan ScrapeResult
 
 	defer func(begun time.Time) {
 		// other error
@@ -296,37 +832,68 @@ func (e *Exporter) scrape(ch chan<- prometheus.Metric, tick *time.Time) {
 		}
 
 		// scrape error
+		if errChan == nil {
+			return
+		}
 		close(errChan)
 		for scrape := range errChan {
 			if scrape.Err != nil {
-				if shouldLogScrapeError(scrape.Err, scrape.Metric.IgnoreZeroResult) {
+				if isConnectionWaitError(scrape.Err) {
+					level.Error(e.logger).Log("msg", "Error scraping metric, no database connection was free in time. The query did not run. "+
+						"Raise database.maxOpenConns, lower scrape.maxConcurrent, or raise database.connectionWaitTimeout.",
+						"Context", scrape.Metric.Context,
+						"file", scrape.Metric.SourceFile,
+						"error", scrape.Err)
+				} else if isTableNotFoundError(scrape.Err) {
+					level.Error(e.logger).Log("msg", tableNotFoundHint(e.sessionUser),
+						"Context", scrape.Metric.Context,
+						"file", scrape.Metric.SourceFile,
+						"error", scrape.Err)
+				} else if shouldLogScrapeError(scrape.Kind, scrape.Metric.IgnoreZeroResult) {
 					level.Error(e.logger).Log("msg", "Error scraping metric",
 						"Context", scrape.Metric.Context,
-						"MetricsDesc", fmt.Sprint(scrape.Metric.MetricsDesc),
+						"file", scrape.Metric.SourceFile,
+						"kind", scrape.Kind,
+						"MetricsDesc", e.logValue(scrape.Metric.MetricsDesc),
 						"time", time.Since(scrape.ScrapeStart),
 						"error", scrape.Err)
 				}
-				e.scrapeErrors.WithLabelValues(scrape.Metric.Context).Inc()
+				e.scrapeErrors.WithLabelValues(scrape.Metric.Context, string(scrape.Kind)).Inc()
+				if scrape.Kind == ErrorKindTimeout {
+					e.queryTimeouts.WithLabelValues(scrape.Metric.Context).Inc()
+				}
 			}
 		}
 
 	}(time.Now())
 
-	if err = e.db.Ping(); err != nil {
+	if e.config.PasswordFile != "" && !e.externalDB && e.checkIfPasswordChanged() {
+		level.Info(e.logger).Log("msg", "Reconnecting to DB with the new password")
+		e.db.Close()
+		if err = e.connect(); err != nil {
+			level.Error(e.logger).Log("msg", "Error reconnecting to DB", "error", err)
+		}
+	}
+
+	if err = e.healthCheck(ctx); err != nil {
 		level.Debug(e.logger).Log("msg", "error = "+err.Error())
 		if strings.Contains(err.Error(), "sql: database is closed") {
 			level.Info(e.logger).Log("msg", "Reconnecting to DB")
-			err = e.connect()
+			e.up.Set(0)
+			err = e.reconnectWithBackoff()
 			if err != nil {
-				level.Error(e.logger).Log("msg", "Error reconnecting to DB", err)
+				level.Error(e.logger).Log("msg", "Error reconnecting to DB", "error", err)
 			}
 		}
 	}
 
-	if err = e.db.Ping(); err != nil {
+	if err = e.healthCheck(ctx); err != nil {
 		level.Error(e.logger).Log("msg", "Error pinging oracle",
 			"error", err)
 		e.up.Set(0)
+		if e.config.EmitLastValueOnFailure {
+			e.sendLastValues(ch)
+		}
 		return
 	}
 
@@ -335,28 +902,54 @@ func (e *Exporter) scrape(ch chan<- prometheus.Metric, tick *time.Time) {
 	level.Debug(e.logger).Log("msg", "Successfully pinged Oracle database: "+maskDsn(e.connectString))
 	e.up.Set(1)
 
+	if drift, err := e.timeDrift(ctx); err != nil {
+		level.Debug(e.logger).Log("msg", "Unable to get the database time", "error", err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(e.timeDriftDesc, prometheus.GaugeValue, drift.Seconds())
+	}
+
 	if e.checkIfMetricsChanged() {
-		e.reloadMetrics()
+		if err := e.reloadMetrics(); err != nil {
+			// the files that failed keep the metrics loaded from them last, the failure is shown by config_reload_success
+			level.Error(e.logger).Log("msg", "Error reloading metrics, keeping the previous metrics of the files with errors", "error", err)
+		}
 	}
 
+	errChan = make(chan ScrapeResult, len(e.metricsToScrape.Metric))
+	maxConcurrentScrapes := e.config.MaxConcurrentScrapes
+	if maxConcurrentScrapes < 1 {
+		maxConcurrentScrapes = 1
+	}
+	sem := newPrioritySemaphore(maxConcurrentScrapes)
 	wg := sync.WaitGroup{}
+	e.scrapeGoroutines.resetPeak()
+	e.scrapeQueue.resetPeak()
 
-	for _, metric := range e.metricsToScrape.Metric {
+	// started highest priority first, so that they are first in line for the query slots
+	metrics := slices.Clone(e.metricsToScrape.Metric)
+	slices.SortStableFunc(metrics, func(a, b Metric) int { return cmp.Compare(b.Priority, a.Priority) })
+	for _, metric := range metrics {
 		wg.Add(1)
 		metric := metric //https://golang.org/doc/faq#closures_and_goroutines
 
+		e.scrapeGoroutines.add(1)
 		go func() {
 			defer wg.Done()
+			defer e.scrapeGoroutines.add(-1)
 
 			level.Debug(e.logger).Log("msg", "About to scrape metric",
 				"Context", metric.Context,
-				"MetricsDesc", fmt.Sprint(metric.MetricsDesc),
-				"MetricsType", fmt.Sprint(metric.MetricsType),
-				"MetricsBuckets", fmt.Sprint(metric.MetricsBuckets), // ignored unless histogram
-				"Labels", fmt.Sprint(metric.Labels),
+				"MetricsDesc", e.logValue(metric.MetricsDesc),
+				"MetricsType", e.logValue(metric.MetricsType),
+				"MetricsBuckets", e.logValue(metric.MetricsBuckets), // ignored unless histogram
+				"MetricsQuantiles", e.logValue(metric.MetricsQuantiles), // ignored unless summary
+				"Labels", e.logValue(metric.Labels),
 				"FieldToAppend", metric.FieldToAppend,
 				"IgnoreZeroResult", metric.IgnoreZeroResult,
-				"Request", metric.Request)
+				"NullValue", metric.NullValue,
+				"Request", e.redactSQL(metric.Request),
+				"PLSQL", metric.PLSQL,
+				"Bindings", e.logValue(e.redactBindings(metric.Bindings)))
 
 			if len(metric.Request) == 0 {
 				level.Error(e.logger).Log("msg", "Error scraping for "+fmt.Sprint(metric.MetricsDesc)+". Did you forget to define request in your toml file?")
@@ -364,11 +957,12 @@ func (e *Exporter) scrape(ch chan<- prometheus.Metric, tick *time.Time) {
 			}
 
 			if len(metric.MetricsDesc) == 0 {
-				level.Error(e.logger).Log("msg", "Error scraping for query"+fmt.Sprint(metric.Request)+". Did you forget to define metricsdesc  in your toml file?")
+				level.Error(e.logger).Log("msg", "Error scraping for query"+e.redactSQL(metric.Request)+". Did you forget to define metricsdesc  in your toml file?")
 				return
 			}
 
-			for column, metricType := range metric.MetricsType {
+			for column := range metric.MetricsType {
+				metricType := metricTypeOf(column, metric.MetricsType)
 				if metricType == "histogram" {
 					_, ok := metric.MetricsBuckets[column]
 					if !ok {
@@ -376,19 +970,44 @@ func (e *Exporter) scrape(ch chan<- prometheus.Metric, tick *time.Time) {
 						return
 					}
 				}
+				if metricType == "summary" {
+					_, ok := metric.MetricsQuantiles[column]
+					if !ok {
+						level.Error(e.logger).Log("msg", "Unable to find MetricsQuantiles configuration key for metric. (metric="+column+")")
+						return
+					}
+				}
+			}
+
+			// e.g. skip metrics that need an open database on a mounted physical standby
+			if !e.matchesDatabaseRole(metric) {
+				level.Debug(e.logger).Log("msg", "Skipping metric for database role",
+					"Context", metric.Context,
+					"DatabaseRole", metric.DatabaseRole,
+					"role", e.databaseRole)
+				return
+			}
+			if !e.matchesASMAccess(metric) {
+				return
 			}
 
 			scrapeStart := time.Now()
 			if err1 := func() error {
-				scrapemutex.Lock()
-				defer scrapemutex.Unlock()
-				return e.ScrapeMetric(e.db, ch, metric, tick)
+				e.scrapeQueue.add(1)
+				err := sem.acquire(ctx, metric.Priority)
+				e.scrapeQueue.add(-1)
+				if err != nil {
+					// the scrape was cancelled while the metric waited for a free slot
+					return err
+				}
+				defer sem.release()
+				return e.ScrapeMetric(ctx, e.db, ch, metric, tick)
 			}(); err1 != nil {
-				errChan <- ScrapeResult{Err: err1, Metric: metric, ScrapeStart: scrapeStart}
+				errChan <- ScrapeResult{Err: err1, Kind: errorKind(err1), Metric: metric, ScrapeStart: scrapeStart}
 			} else {
 				level.Debug(e.logger).Log("msg", "Successfully scraped metric",
 					"Context", metric.Context,
-					"MetricDesc", fmt.Sprint(metric.MetricsDesc),
+					"MetricDesc", e.logValue(metric.MetricsDesc),
 					"time", time.Since(scrapeStart))
 			}
 		}()
@@ -399,15 +1018,71 @@ func (e *Exporter) scrape(ch chan<- prometheus.Metric, tick *time.Time) {
 func (e *Exporter) connect() error {
 	level.Debug(e.logger).Log("msg", "Launching connection to "+maskDsn(e.connectString))
 
+	P, err := e.connectionParams()
+	if err != nil {
+		return err
+	}
+
+	// note that this just configures the connection, it does not actually connect until later
+	// when we call db.Ping()
+	db := sql.OpenDB(godror.NewConnector(P))
+	level.Debug(e.logger).Log("set max idle connections to ", e.config.MaxIdleConns)
+	db.SetMaxIdleConns(e.config.MaxIdleConns)
+	level.Debug(e.logger).Log("set max open connections to ", e.config.MaxOpenConns)
+	db.SetMaxOpenConns(e.config.MaxOpenConns)
+	level.Debug(e.logger).Log("set max connection lifetime to ", e.config.ConnMaxLifetime)
+	db.SetConnMaxLifetime(e.config.ConnMaxLifetime)
+	level.Debug(e.logger).Log("set max connection idle time to ", e.config.ConnMaxIdleTime)
+	db.SetConnMaxIdleTime(e.config.ConnMaxIdleTime)
+	level.Debug(e.logger).Log("msg", "Successfully configured connection to "+maskDsn(e.connectString))
+	e.dbMu.Lock()
+	e.db = db
+	e.dbMu.Unlock()
+
+	if _, err := db.Exec(`
+			begin
+	       		dbms_application_info.set_client_info('oracledb_exporter');
+			end;`); err != nil {
+		level.Info(e.logger).Log("msg", "Could not set CLIENT_INFO.")
+	}
+
+	e.probe()
+	return nil
+}
+
+// connectionParams returns the godror connection parameters of the exporter's configuration, getting the password
+// or access token from their providers
+func (e *Exporter) connectionParams() (godror.ConnectionParams, error) {
 	var P godror.ConnectionParams
-	// If password is not specified, externalAuth will be true and we'll ignore user input
-	e.externalAuth = e.password == ""
-	level.Debug(e.logger).Log("external authentication set to ", e.externalAuth)
+	if e.config.SecretProvider != nil {
+		password, err := e.config.SecretProvider.GetPassword(context.Background())
+		if err != nil {
+			return P, fmt.Errorf("unable to get the database password: %w", err)
+		}
+		e.password = password
+	}
+	// ExternalAuth forces external authentication, e.g. Kerberos, keeping the user. Otherwise, if password
+	// is not specified, externalAuth will be true and we'll ignore user input
 	msg := "Using Username/Password Authentication."
-	if e.externalAuth {
+	if e.config.TokenProvider != nil {
+		// the token identifies the user, so there is no user or password, but it is not a wallet or OS external identity
+		token, privateKey, err := e.config.TokenProvider.GetToken(context.Background())
+		if err != nil {
+			return P, fmt.Errorf("unable to get the database access token: %w", err)
+		}
+		P.Token, P.PrivateKey = token, privateKey
+		P.TokenCB = e.refreshToken
+		e.externalAuth = true
+		e.user, e.password = "", ""
+		msg = "Using access token authentication."
+	} else if e.config.ExternalAuth {
+		e.externalAuth = true
+		msg = "External authentication requested; using external authentication as user " + e.user + "."
+	} else if e.externalAuth = e.password == ""; e.externalAuth {
 		msg = "Database Password not specified; will attempt to use external authentication (ignoring user input)."
 		e.user = ""
 	}
+	level.Debug(e.logger).Log("external authentication set to ", e.externalAuth)
 	level.Info(e.logger).Log("msg", msg)
 	externalAuth := sql.NullBool{
 		Bool:  e.externalAuth,
@@ -415,9 +1090,29 @@ func (e *Exporter) connect() error {
 	}
 	P.Username, P.Password, P.ConnectString, P.ExternalAuth = e.user, godror.NewPassword(e.password), e.connectString, externalAuth
 
+	// proxy authentication connects as the user, or the external identity, into the proxy user's schema
+	if e.config.ProxyUser != "" {
+		level.Info(e.logger).Log("msg", "Using proxy authentication into "+e.config.ProxyUser)
+		P.Username = e.user + "[" + e.config.ProxyUser + "]"
+	}
+
 	// if TNS_ADMIN env var is set, set ConfigDir to that location
 	P.ConfigDir = e.configDir
 
+	// if a wallet location is given, use it to find sqlnet.ora/tnsnames.ora when TNS_ADMIN is not set,
+	// and tell tcps:// easy connect strings where to find the wallet
+	if e.config.WalletLocation != "" {
+		level.Debug(e.logger).Log("msg", "Using wallet at "+e.config.WalletLocation)
+		if P.ConfigDir == "" {
+			P.ConfigDir = e.config.WalletLocation
+		}
+		P.ConnectString = withWalletLocation(P.ConnectString, e.config.WalletLocation)
+	}
+
+	if e.config.CheckTNSAlias {
+		e.checkTNSAlias(P.ConfigDir)
+	}
+
 	if strings.ToUpper(e.config.DbRole) == "SYSDBA" {
 		P.IsSysDBA = true
 	}
@@ -426,31 +1121,58 @@ func (e *Exporter) connect() error {
 		P.IsSysOper = true
 	}
 
-	level.Debug(e.logger).Log("msg", "connection properties: "+fmt.Sprint(P))
+	// run on every new connection, as the pool can open one at any time.
+	// The decimal separator is set first, so that numbers formatted as text by a request, e.g. with TO_CHAR, can be parsed
+	// whatever the NLS settings of the database or client, unless the session init SQL sets it again.
+	P.OnInit = sessionInit(append([]string{numericCharactersSQL}, e.config.SessionInitSQL...))
 
-	// note that this just configures the connection, it does not actually connect until later
-	// when we call db.Ping()
-	db := sql.OpenDB(godror.NewConnector(P))
-	level.Debug(e.logger).Log("set max idle connections to ", e.config.MaxIdleConns)
-	db.SetMaxIdleConns(e.config.MaxIdleConns)
-	level.Debug(e.logger).Log("set max open connections to ", e.config.MaxOpenConns)
-	db.SetMaxOpenConns(e.config.MaxOpenConns)
-	db.SetConnMaxLifetime(0)
-	level.Debug(e.logger).Log("msg", "Successfully configured connection to "+maskDsn(e.connectString))
-	e.db = db
+	level.Debug(e.logger).Log(connectionParamsLog(P)...)
+	return P, nil
+}
 
-	if _, err := db.Exec(`
-			begin
-	       		dbms_application_info.set_client_info('oracledb_exporter');
-			end;`); err != nil {
-		level.Info(e.logger).Log("msg", "Could not set CLIENT_INFO.")
+// probe finds out the type, service, instance and Data Guard role of the database the exporter is connected to
+func (e *Exporter) probe() {
+	db := e.db
+	e.dbtype = e.probeDBType()
+
+	var serviceName string
+	if err := db.QueryRow("select sys_context('USERENV', 'SERVICE_NAME') from dual").Scan(&serviceName); err != nil {
+		level.Info(e.logger).Log("msg", "got error checking my database service name")
+	}
+	e.serviceName = serviceName
+
+	var sessionUser string
+	if err := db.QueryRow("select user from dual").Scan(&sessionUser); err != nil {
+		level.Info(e.logger).Log("msg", "got error checking my database user", "error", err)
+	}
+	e.sessionUser = sessionUser
+
+	var instanceName string
+	if err := db.QueryRow("select sys_context('USERENV', 'INSTANCE_NAME') from dual").Scan(&instanceName); err != nil {
+		level.Info(e.logger).Log("msg", "got error checking my database instance name")
+	}
+	e.instanceName = instanceName
+
+	// from 18c, version is the base release, e.g. 19.0.0.0.0, and version_full has the release update, e.g. 19.21.0.0.0
+	var version, instance, host string
+	err := db.QueryRow("select version_full, instance_name, host_name from v$instance").Scan(&version, &instance, &host)
+	if err != nil {
+		err = db.QueryRow("select version, instance_name, host_name from v$instance").Scan(&version, &instance, &host)
+	}
+	if err != nil {
+		level.Info(e.logger).Log("msg", "got error checking my database instance details", "error", err)
+	} else {
+		e.dbVersion = version
+		e.instanceInfo.Reset()
+		e.instanceInfo.WithLabelValues(version, instance, host).Set(1)
 	}
 
-	var result int
-	if err := db.QueryRow("select sys_context('USERENV', 'CON_ID') from dual").Scan(&result); err != nil {
-		level.Info(e.logger).Log("msg", "dbtype err ="+string(err.Error()))
+	var databaseRole string
+	if err := db.QueryRow("select database_role from v$database").Scan(&databaseRole); err != nil {
+		level.Info(e.logger).Log("msg", "got error checking my Data Guard role", "error", err)
 	}
-	e.dbtype = result
+	e.databaseRole = databaseRole
+	level.Info(e.logger).Log("msg", "Database role: "+databaseRole)
 
 	var sysdba string
 	if err := db.QueryRow("select sys_context('USERENV', 'ISDBA') from dual").Scan(&sysdba); err != nil {
@@ -458,19 +1180,277 @@ func (e *Exporter) connect() error {
 	}
 	level.Info(e.logger).Log("msg", "Connected as SYSDBA? "+sysdba)
 
+	e.asmAccess = e.probeASMAccess()
+}
+
+// dbtypeUnknown is the dbtype when it cannot be determined, so that it is not mistaken for a non-CDB
+const dbtypeUnknown = -1
+
+// probeDBType returns the container ID of the session, which is 0 for a non-CDB, 1 for the CDB root and more than 1 for a PDB.
+// If the container ID cannot be read, e.g. on some read-only standbys, the CDB column of v$database is used instead,
+// and if that fails too, dbtypeUnknown is returned.
+func (e *Exporter) probeDBType() int {
+	var conID int
+	err := e.db.QueryRow("select sys_context('USERENV', 'CON_ID') from dual").Scan(&conID)
+	if err == nil {
+		return conID
+	}
+	level.Warn(e.logger).Log("msg", "Unable to get the container ID, checking v$database instead", "error", err)
+
+	var cdb string
+	err = e.db.QueryRow("select cdb from v$database").Scan(&cdb)
+	if err == nil {
+		if strings.EqualFold(cdb, "YES") {
+			return 1
+		}
+		return 0
+	}
+	if oraErr, ok := godror.AsOraErr(err); ok && oraErr.Code() == 904 {
+		// ORA-00904: invalid identifier, there is no CDB column before 12c, so the database cannot be a CDB
+		return 0
+	}
+	level.Warn(e.logger).Log("msg", "Unable to determine the database type, oracledb_dbtype will be -1", "error", err)
+	return dbtypeUnknown
+}
+
+// maxReconnectRetries is the most times the delay between reconnect attempts can be doubled, and maxReconnectBackoff
+// the longest delay, with jitter added, so that the delay cannot overflow whatever the configuration
+const (
+	maxReconnectRetries = 30
+	maxReconnectBackoff = time.Hour
+)
+
+// reconnectWithBackoff makes one attempt to reconnect to the database, closing the old connection pool first.
+// It is called with mu held, so rather than sleeping between attempts it skips the reconnect until the backoff
+// delay has passed. The delay starts at ReconnectBackoff and doubles after each failed attempt, up to
+// ReconnectMaxRetries times and at most maxReconnectBackoff, with up to 50% jitter added.
+func (e *Exporter) reconnectWithBackoff() error {
+	if e.externalDB {
+		return errors.New("the database was supplied to NewExporterWithDB, and cannot be reconnected by the exporter")
+	}
+	if wait := time.Until(e.nextReconnect); wait > 0 {
+		return fmt.Errorf("waiting %s before the next attempt to reconnect", wait.Round(time.Millisecond))
+	}
+	e.reconnects.Inc()
+	if e.db != nil {
+		e.db.Close()
+	}
+	err := e.connect()
+	if err == nil {
+		err = e.db.Ping()
+	}
+	if err == nil {
+		e.reconnectFailures = 0
+		e.nextReconnect = time.Time{}
+		return nil
+	}
+	delay := e.reconnectDelay()
+	e.reconnectFailures++
+	e.nextReconnect = time.Now().Add(delay)
+	level.Info(e.logger).Log("msg", "Waiting before retrying connection to DB",
+		"attempt", e.reconnectFailures,
+		"delay", delay,
+		"error", err)
+	return err
+}
+
+// reconnectDelay returns the delay before the next attempt to reconnect, after reconnectFailures failed attempts
+func (e *Exporter) reconnectDelay() time.Duration {
+	backoff := min(e.config.ReconnectBackoff, maxReconnectBackoff)
+	for i := 0; i < min(e.reconnectFailures, e.config.ReconnectMaxRetries) && backoff < maxReconnectBackoff; i++ {
+		backoff = min(2*backoff, maxReconnectBackoff)
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+}
+
+// UpdateConnectString switches the exporter to another connect string, e.g. to follow a planned failover or
+// relocation of the database without restarting the exporter. It waits for any in-flight scrape to finish,
+// closes the connection pool and connects with the new connect string, with the up gauge set to 0 until
+// the database can be reached. If it cannot, the error is returned, and the exporter keeps trying to
+// reconnect with the new connect string on each scrape.
+func (e *Exporter) UpdateConnectString(connectString string) error {
+	if e.externalDB {
+		return errors.New("the database was supplied to NewExporterWithDB, and cannot be reconnected by the exporter")
+	}
+	if connectString == "" {
+		return errors.New("the connect string cannot be empty")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	level.Info(e.logger).Log("msg", "Switching to a new connect string",
+		"from", maskDsn(e.connectString),
+		"to", maskDsn(connectString))
+	e.up.Set(0)
+	if e.db != nil {
+		e.db.Close()
+	}
+	e.connectString = connectString
+	if err := e.connect(); err != nil {
+		return err
+	}
+	if err := e.healthCheck(context.Background()); err != nil {
+		return err
+	}
+	e.up.Set(1)
 	return nil
 }
 
+// Ready returns an error if the database cannot be reached, by running the health check query.
+// It does not wait for, or block, a scrape that is in progress, so it is suitable for a readiness probe.
+//
+// For example, to serve a Kubernetes readiness probe on /readyz:
+//
+//	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+//		if err := exporter.Ready(r.Context()); err != nil {
+//			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+//		}
+//	})
+func (e *Exporter) Ready(ctx context.Context) error {
+	if e.getDB() == nil {
+		return errors.New("not connected to the database")
+	}
+	return e.healthCheck(ctx)
+}
+
+// healthCheck runs the health check query, which unlike a ping checks that the session can run a query,
+// e.g. that it is not left half-open after a PDB relocation. The database is pinged if there is no health check query.
+func (e *Exporter) healthCheck(ctx context.Context) error {
+	// Ready runs the health check without holding mu
+	db := e.getDB()
+	if e.config.HealthCheckQuery == "" {
+		return db.PingContext(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.config.QueryTimeout)*time.Second)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, e.config.HealthCheckQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// timeDrift returns how far the database's clock is ahead of the exporter's. The database time is fetched as
+// text in UTC, so that neither the database, session or driver time zones affect it, and is compared to the
+// local time halfway through the query, to allow for the round trip.
+func (e *Exporter) timeDrift(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.config.QueryTimeout)*time.Second)
+	defer cancel()
+	var dbTime string
+	before := time.Now()
+	err := e.db.QueryRowContext(ctx, `select to_char(sys_extract_utc(systimestamp), 'YYYY-MM-DD"T"HH24:MI:SS.FF6') from dual`).Scan(&dbTime)
+	if err != nil {
+		return 0, err
+	}
+	local := before.Add(time.Since(before) / 2)
+	t, err := time.ParseInLocation("2006-01-02T15:04:05.999999", dbTime, time.UTC)
+	if err != nil {
+		return 0, err
+	}
+	return t.Sub(local), nil
+}
+
+// withWalletLocation adds the wallet_location parameter to an easy connect plus tcps:// connect string,
+// unless one is already present. Other connect strings (TNS aliases, descriptors) are returned unchanged.
+func withWalletLocation(connectString, walletLocation string) string {
+	if !strings.HasPrefix(strings.ToLower(connectString), "tcps://") ||
+		strings.Contains(strings.ToLower(connectString), "wallet_location=") {
+		return connectString
+	}
+	sep := "?"
+	if strings.Contains(connectString, "?") {
+		sep = "&"
+	}
+	return connectString + sep + "wallet_location=" + walletLocation
+}
+
+// ServiceName returns the name of the database service the exporter is connected to
+func (e *Exporter) ServiceName() string {
+	return e.serviceName
+}
+
+// DatabaseRole returns the Data Guard role of the database, e.g. PRIMARY or PHYSICAL STANDBY
+func (e *Exporter) DatabaseRole() string {
+	return e.databaseRole
+}
+
+// matchesDatabaseRole returns true if the metric should be scraped in the current database role.
+// Metrics without a DatabaseRole, and all metrics when the role is not known, are always scraped.
+func (e *Exporter) matchesDatabaseRole(metric Metric) bool {
+	if metric.DatabaseRole == "" || e.databaseRole == "" {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSpace(metric.DatabaseRole), e.databaseRole)
+}
+
 // this is used by the log exporter to share the database connection
 func (e *Exporter) GetDB() *sql.DB {
+	return e.getDB()
+}
+
+// getDB returns the current connection pool, for use without holding mu, e.g. while a scrape may be reconnecting
+func (e *Exporter) getDB() *sql.DB {
+	e.dbMu.RLock()
+	defer e.dbMu.RUnlock()
 	return e.db
 }
 
-func (e *Exporter) checkIfMetricsChanged() bool {
-	for i, _customMetrics := range strings.Split(e.config.CustomMetrics, ",") {
+// CustomMetricsFiles returns the files in a comma separated list of custom metrics files and directories.
+// A directory is expanded to the *.toml, *.yaml and *.yml files in it, in name order, so files can be added to it without changing the list.
+func CustomMetricsFiles(customMetrics string) ([]string, error) {
+	files := []string{}
+	for _, _customMetrics := range strings.Split(customMetrics, ",") {
 		if len(_customMetrics) == 0 {
 			continue
 		}
+		info, err := os.Stat(_customMetrics)
+		if err != nil || !info.IsDir() {
+			// missing files are reported when they are read
+			files = append(files, _customMetrics)
+			continue
+		}
+		var dirFiles []string
+		for _, ext := range metricsFileExtensions {
+			extFiles, err := filepath.Glob(filepath.Join(_customMetrics, "*"+ext))
+			if err != nil {
+				return nil, err
+			}
+			dirFiles = append(dirFiles, extFiles...)
+		}
+		sort.Strings(dirFiles)
+		files = append(files, dirFiles...)
+	}
+	return files, nil
+}
+
+// checkIfMetricsChanged returns true if a custom metrics file has been changed, added or removed since the last check.
+// The hashes are keyed by file name and all of them are refreshed on every check, so that reordering the list of files
+// does not cause a reload, and a reload is not triggered again on the next check for another file that changed at the same time.
+func (e *Exporter) checkIfMetricsChanged() bool {
+	files, err := CustomMetricsFiles(e.config.CustomMetrics)
+	if err != nil {
+		level.Error(e.logger).Log("msg", "Unable to list custom metrics files", "error", err)
+		return false
+	}
+	changed := false
+	// a file that is no longer in the list, or was removed from a directory, changes the metrics
+	current := make(map[string]bool, len(files))
+	for _, file := range files {
+		current[file] = true
+	}
+	for file := range e.hashMap {
+		if !current[file] {
+			level.Info(e.logger).Log("msg", file+" has been removed. Reloading metrics...")
+			delete(e.hashMap, file)
+			changed = true
+		}
+	}
+	for _, _customMetrics := range files {
 		level.Debug(e.logger).Log("msg", "Checking modifications in following metrics definition file:"+_customMetrics)
 		h := sha256.New()
 		if err := hashFile(h, _customMetrics); err != nil {
@@ -478,13 +1458,36 @@ func (e *Exporter) checkIfMetricsChanged() bool {
 			return false
 		}
 		// If any of files has been changed reload metrics
-		if !bytes.Equal(hashMap[i], h.Sum(nil)) {
+		if !bytes.Equal(e.hashMap[_customMetrics], h.Sum(nil)) {
 			level.Info(e.logger).Log("msg", _customMetrics+" has been changed. Reloading metrics...")
-			hashMap[i] = h.Sum(nil)
-			return true
+			e.hashMap[_customMetrics] = h.Sum(nil)
+			changed = true
 		}
 	}
-	return false
+	return changed
+}
+
+// checkIfPasswordChanged reads the password from the password file if the file has changed since it was last read
+func (e *Exporter) checkIfPasswordChanged() bool {
+	h := sha256.New()
+	if err := hashFile(h, e.config.PasswordFile); err != nil {
+		level.Error(e.logger).Log("msg", "Unable to get password file hash", "error", err)
+		return false
+	}
+	if bytes.Equal(e.passwordHash, h.Sum(nil)) {
+		return false
+	}
+	password, err := os.ReadFile(e.config.PasswordFile)
+	if err != nil {
+		level.Error(e.logger).Log("msg", "Unable to read password file", "error", err)
+		return false
+	}
+	if e.passwordHash != nil {
+		level.Info(e.logger).Log("msg", e.config.PasswordFile+" has been changed. Reloading password...")
+	}
+	e.password = strings.TrimSpace(string(password))
+	e.passwordHash = h.Sum(nil)
+	return true
 }
 
 func hashFile(h hash.Hash, fn string) error {
@@ -499,131 +1502,410 @@ func hashFile(h hash.Hash, fn string) error {
 	return nil
 }
 
-func (e *Exporter) reloadMetrics() {
-	// Truncate metricsToScrape
-	e.metricsToScrape.Metric = []Metric{}
+// ReloadMetrics reloads the default and custom metrics definitions straight away, rather than waiting for
+// a change to the custom metrics files to be noticed on the next scrape. It waits for any in-flight scrape to finish.
+// If a custom metrics file cannot be loaded, it is skipped and the metrics loaded from it before are kept,
+// the other files are loaded, and the errors are returned.
+//
+// For example, to reload the metrics on a POST to /-/reload:
+//
+//	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+//		if err := exporter.ReloadMetrics(); err != nil {
+//			http.Error(w, err.Error(), http.StatusInternalServerError)
+//		}
+//	})
+func (e *Exporter) ReloadMetrics() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.reloadMetrics()
+}
+
+// reloadMetrics loads the default and custom metrics, recording whether they loaded and when
+func (e *Exporter) reloadMetrics() error {
+	if err := e.loadMetrics(); err != nil {
+		e.reloadSuccess.Set(0)
+		return err
+	}
+	e.reloadSuccess.Set(1)
+	e.reloadTime.SetToCurrentTime()
+	return nil
+}
 
+// loadMetrics loads the default and custom metrics, replacing metricsToScrape only once all have been loaded.
+// A custom metrics file that cannot be loaded is skipped, keeping the metrics loaded from it before, so that
+// a mistake in one file doesn't stop the metrics of the others being scraped.
+func (e *Exporter) loadMetrics() error {
 	// Load default metrics
 	defaultMetrics := e.DefaultMetrics()
-	e.metricsToScrape.Metric = defaultMetrics.Metric
+	metrics := defaultMetrics.Metric
+	var fileErrs []error
 
 	// If custom metrics, load it
 	if strings.Compare(e.config.CustomMetrics, "") != 0 {
-		for _, _customMetrics := range strings.Split(e.config.CustomMetrics, ",") {
-			if _, err := toml.DecodeFile(_customMetrics, &additionalMetrics); err != nil {
-				level.Error(e.logger).Log(err)
-				panic(errors.New("Error while loading " + _customMetrics))
+		files, err := CustomMetricsFiles(e.config.CustomMetrics)
+		if err != nil {
+			return err
+		}
+		// reset so that files no longer in the list are not reported
+		e.metricsFileValid.Reset()
+		for _, _customMetrics := range files {
+			additionalMetrics, err := e.loadMetricsFile(_customMetrics)
+			if err != nil {
+				level.Error(e.logger).Log("msg", "Error while loading "+_customMetrics+", skipping it and keeping the metrics loaded from it before",
+					"error", err)
+				e.metricsFileValid.WithLabelValues(_customMetrics).Set(0)
+				fileErrs = append(fileErrs, fmt.Errorf("%s: %w", _customMetrics, err))
+				additionalMetrics = e.loadedFrom(_customMetrics)
 			} else {
 				level.Info(e.logger).Log("msg", "Successfully loaded custom metrics from "+_customMetrics)
+				e.metricsFileValid.WithLabelValues(_customMetrics).Set(1)
 			}
-			e.metricsToScrape.Metric = append(e.metricsToScrape.Metric, additionalMetrics.Metric...)
+			metrics = append(metrics, additionalMetrics...)
 		}
 	} else {
 		level.Debug(e.logger).Log("msg", "No custom metrics defined.")
 	}
+
+	metrics, unknown := filterCollectors(metrics, e.config.IncludeCollectors, e.config.ExcludeCollectors)
+	for _, name := range unknown {
+		level.Warn(e.logger).Log("msg", "Included or excluded collector does not match the context of any metric", "collector", name)
+	}
+
+	normalizeMetrics(metrics)
+	e.generateBuckets(metrics)
+
+	e.metricsToScrape.Metric = metrics
+	e.setCollectorInfo()
+	return errors.Join(fileErrs...)
+}
+
+// loadMetricsFile decodes and validates a custom metrics file, and returns its metrics if every one of them is valid
+func (e *Exporter) loadMetricsFile(file string) ([]Metric, error) {
+	var metrics Metrics
+	if err := decodeMetricsFile(file, &metrics); err != nil {
+		return nil, err
+	}
+	normalizeMetrics(metrics.Metric)
+	var errs []error
+	for i, metric := range metrics.Metric {
+		for _, err := range validateMetric(metric) {
+			errs = append(errs, fmt.Errorf("metric %d (context=%s): %w", i+1, metric.Context, err))
+		}
+	}
+	if err := checkConstLabels(metrics.Metric, e.config.ConstLabels); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	setSourceFile(metrics.Metric, file)
+	return metrics.Metric, nil
+}
+
+// loadedFrom returns the metrics that are being scraped that were loaded from the file
+func (e *Exporter) loadedFrom(file string) []Metric {
+	var metrics []Metric
+	for _, m := range e.metricsToScrape.Metric {
+		if m.SourceFile == file {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// setCollectorInfo records the file each collector was loaded from in the collector_info metric
+func (e *Exporter) setCollectorInfo() {
+	e.collectorInfo.Reset()
+	for _, m := range e.metricsToScrape.Metric {
+		e.collectorInfo.WithLabelValues(m.Context, m.SourceFile).Set(1)
+	}
+}
+
+// setSourceFile records the file the metrics were loaded from
+func setSourceFile(metrics []Metric, file string) {
+	for i := range metrics {
+		metrics[i].SourceFile = file
+	}
+}
+
+// filterCollectors keeps the metrics whose context is in include (or all of them if include is empty),
+// and removes those whose context is in exclude. Exclude wins if a context is in both.
+// It also returns the included and excluded names that do not match the context of any metric.
+func filterCollectors(metrics []Metric, include, exclude []string) ([]Metric, []string) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return metrics, nil
+	}
+	contexts := map[string]bool{}
+	for _, metric := range metrics {
+		contexts[metric.Context] = true
+	}
+	var unknown []string
+	toSet := func(names []string) map[string]bool {
+		set := map[string]bool{}
+		for _, name := range names {
+			set[name] = true
+			if !contexts[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		return set
+	}
+	included, excluded := toSet(include), toSet(exclude)
+
+	filtered := make([]Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		if excluded[metric.Context] || (len(included) > 0 && !included[metric.Context]) {
+			continue
+		}
+		filtered = append(filtered, metric)
+	}
+	return filtered, unknown
 }
 
 // ScrapeMetric is an interface method to call scrapeGenericValues using Metric struct values
-func (e *Exporter) ScrapeMetric(db *sql.DB, ch chan<- prometheus.Metric, m Metric, tick *time.Time) error {
+func (e *Exporter) ScrapeMetric(ctx context.Context, db Querier, ch chan<- prometheus.Metric, m Metric, tick *time.Time) error {
 	level.Debug(e.logger).Log("msg", "Calling function ScrapeGenericValues()")
+	if !e.matchesDBVersion(m) {
+		level.Debug(e.logger).Log("msg", "Skipping metric for database version",
+			"Context", m.Context,
+			"MinDBVersion", m.MinDBVersion,
+			"MaxDBVersion", m.MaxDBVersion,
+			"version", e.dbVersion)
+		return nil
+	}
 	if e.isScrapeMetric(tick, m) {
-		queryTimeout := e.getQueryTimeout(m)
-		return e.scrapeGenericValues(db, ch, m.Context, m.Labels, m.MetricsDesc,
-			m.MetricsType, m.MetricsBuckets, m.FieldToAppend, m.IgnoreZeroResult,
-			m.Request, queryTimeout)
+		if e.config.EmitLastValueOnFailure {
+			return e.scrapeWithLastValue(m, ch, func(ch chan<- prometheus.Metric) error {
+				return e.scrapeMetricOrCache(ctx, db, ch, m, tick)
+			})
+		}
+		return e.scrapeMetricOrCache(ctx, db, ch, m, tick)
 	}
 	return nil
 }
 
+// scrapeMetricOrCache scrapes the metric, or sends its cached results if it has a cache TTL that has not passed
+func (e *Exporter) scrapeMetricOrCache(ctx context.Context, db Querier, ch chan<- prometheus.Metric, m Metric, tick *time.Time) error {
+	if ttl, ok := e.getCacheTTL(m); ok {
+		return e.scrapeCachedMetric(ctx, db, ch, m, ttl)
+	}
+	if m.SampleEvery > 1 {
+		return e.scrapeSampledMetric(ctx, db, ch, m)
+	}
+	// on a per request scrape, the results are reused until the metric's scrape interval has passed. They are cached
+	// by context and request, so that metrics sharing a context are scraped on their own interval.
+	if interval, ok := e.getScrapeInterval(m.Context, m.ScrapeInterval); ok && tick == nil {
+		return e.scrapeCachedMetric(ctx, db, ch, m, interval)
+	}
+	return e.scrapeMetric(ctx, db, ch, m)
+}
+
+// scrapeMetric runs the query of a metric, recording how long it took and whether it succeeded
+func (e *Exporter) scrapeMetric(ctx context.Context, db Querier, ch chan<- prometheus.Metric, m Metric) error {
+	defer func(begun time.Time) {
+		e.scrapeDuration.WithLabelValues(m.Context).Observe(time.Since(begun).Seconds())
+	}(time.Now())
+	queryTimeout := e.getQueryTimeout(m)
+	err := e.scrapeGenericValues(ctx, db, ch, m, queryTimeout)
+	if err != nil {
+		e.collectorSuccess.WithLabelValues(m.Context).Set(0)
+	} else {
+		e.collectorSuccess.WithLabelValues(m.Context).Set(1)
+	}
+	return err
+}
+
+// descKey identifies a metric descriptor built during a scrape
+type descKey struct {
+	fqName  string
+	help    string
+	labeled bool
+}
+
 // generic method for retrieving metrics.
-func (e *Exporter) scrapeGenericValues(db *sql.DB, ch chan<- prometheus.Metric, context string, labels []string,
-	metricsDesc map[string]string, metricsType map[string]string, metricsBuckets map[string]map[string]string,
-	fieldToAppend string, ignoreZeroResult bool, request string, queryTimeout time.Duration) error {
+func (e *Exporter) scrapeGenericValues(ctx context.Context, db Querier, ch chan<- prometheus.Metric, m Metric, queryTimeout time.Duration) error {
 	metricsCount := 0
+	rowsCount := 0
+	returned := map[string]bool{}
+	var metricTypeErr error
+	helpTemplates := e.parseHelpTemplates(m)
+	labels := m.Labels
+	if m.Container != "" {
+		// metrics scraped in a PDB are labeled with it, so they can be told apart from the same metric in another container
+		labels = append(append([]string{}, m.Labels...), "container")
+	}
+	// the names and descriptors are built once per metric, rather than for every row. With fieldtoappend or a
+	// help template they depend on the row, so they are cached by name and help text instead.
+	fqNames := make(map[string]string, len(m.MetricsDesc))
+	for metric := range m.MetricsDesc {
+		fqNames[metric] = prometheus.BuildFQName(e.namespace, m.Context, metric)
+	}
+	descs := map[descKey]*prometheus.Desc{}
+	getDesc := func(fqName, help string, labels []string) *prometheus.Desc {
+		key := descKey{fqName: fqName, help: help, labeled: len(labels) > 0}
+		desc, ok := descs[key]
+		if !ok {
+			desc = prometheus.NewDesc(fqName, help, labels, e.config.ConstLabels)
+			descs[key] = desc
+		}
+		return desc
+	}
+	// the columns are lower case, the label keeps the case it was given in the metrics file
+	columnLabels := make([]string, len(labels))
+	for i, label := range labels {
+		columnLabels[i] = strings.ToLower(label)
+	}
+	// reused for every row, as the metrics copy the label values they are created with
+	labelsValues := make([]string, 0, len(labels))
+	// the delta series seen by this scrape, the others are forgotten once it is complete
+	deltaPrefix := deltaKeyPrefix(m)
+	seenSeries := map[string]bool{}
+	// the columns of the result, as a NULL column is left out of the row just like one the request doesn't return
+	resultColumns := map[string]bool{}
+	columns := func(cols []string) {
+		clear(resultColumns)
+		for _, col := range cols {
+			resultColumns[strings.ToLower(col)] = true
+		}
+	}
+	// the aggregator keeps the rows it is given, so they cannot be reused
+	reuseRow := m.Streaming && m.Aggregate == ""
+	// a streamed row is parsed as soon as it is read, so with a row limit its metrics are held until all rows have
+	// been read, so that none are sent if the request returns too many rows
+	var held []prometheus.Metric
+	send := func(metric prometheus.Metric) { ch <- metric }
+	if reuseRow && e.getMaxRows(m) > 0 {
+		send = func(metric prometheus.Metric) { held = append(held, metric) }
+	}
 	genericParser := func(row map[string]string) error {
+		rowsCount++
+		if m.Container != "" {
+			row["container"] = m.Container
+		}
 		// Construct labels value
-		labelsValues := []string{}
-		for _, label := range labels {
+		labelsValues = labelsValues[:0]
+		for _, label := range columnLabels {
 			labelsValues = append(labelsValues, row[label])
 		}
 		// Construct Prometheus values to sent back
-		for metric, metricHelp := range metricsDesc {
-			value, err := strconv.ParseFloat(strings.TrimSpace(row[metric]), 64)
-			// If not a float, skip current metric
+		for metric, metricHelp := range m.MetricsDesc {
+			valueType, err := getMetricType(metric, m.MetricsType)
+			// If the type is not valid, skip current metric
 			if err != nil {
-				level.Error(e.logger).Log("msg", "Unable to convert current value to float (metric="+metric+
-					",metricHelp="+metricHelp+",value=<"+row[metric]+">)")
+				level.Error(e.logger).Log("msg", "Unable to get metric type (metric="+metric+
+					",metricHelp="+metricHelp+")", "error", err)
+				metricTypeErr = err
 				continue
 			}
-			level.Debug(e.logger).Log("msg", "Query result",
-				"value", value)
-			// If metric do not use a field content in metric's name
-			if strings.Compare(fieldToAppend, "") == 0 {
-				desc := prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, context, metric),
-					metricHelp,
-					labels, nil,
-				)
-				if metricsType[strings.ToLower(metric)] == "histogram" {
-					count, err := strconv.ParseUint(strings.TrimSpace(row["count"]), 10, 64)
+			var value float64
+			imprecise := false
+			if metricTypeOf(metric, m.MetricsType) == "info" {
+				// an info metric only carries its labels, so it has no column of its own and is always 1
+				returned[metric] = true
+				value = 1
+			} else if rawValue, ok := row[metric]; ok {
+				returned[metric] = true
+				if metricTypeOf(metric, m.MetricsType) == "timestamp" {
+					value, err = e.parseTimestamp(metric, metricHelp, rawValue, m.Timezone, m.DateFormat)
 					if err != nil {
-						level.Error(e.logger).Log("msg", "Unable to convert count value to int (metric="+metric+
-							",metricHelp="+metricHelp+",value=<"+row["count"]+">)")
 						continue
 					}
-					buckets := make(map[float64]uint64)
-					for field, le := range metricsBuckets[metric] {
-						lelimit, err := strconv.ParseFloat(strings.TrimSpace(le), 64)
-						if err != nil {
-							level.Error(e.logger).Log("msg", "Unable to convert bucket limit value to float (metric="+metric+
-								",metricHelp="+metricHelp+",bucketlimit=<"+le+">)")
-							continue
-						}
-						counter, err := strconv.ParseUint(strings.TrimSpace(row[field]), 10, 64)
-						if err != nil {
-							level.Error(e.logger).Log("msg", "Unable to convert ", field, " value to int (metric="+metric+
-								",metricHelp="+metricHelp+",value=<"+row[field]+">)")
-							continue
-						}
-						buckets[lelimit] = counter
-					}
-					ch <- prometheus.MustNewConstHistogram(desc, count, value, buckets, labelsValues...)
-				} else {
-					ch <- prometheus.MustNewConstMetric(desc, getMetricType(metric, metricsType), value, labelsValues...)
-				}
-				// If no labels, use metric name
-			} else {
-				desc := prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, context, cleanName(row[fieldToAppend])),
-					metricHelp,
-					nil, nil,
-				)
-				if metricsType[strings.ToLower(metric)] == "histogram" {
-					count, err := strconv.ParseUint(strings.TrimSpace(row["count"]), 10, 64)
-					if err != nil {
-						level.Error(e.logger).Log("msg", "Unable to convert count value to int (metric="+metric+
-							",metricHelp="+metricHelp+",value=<"+row["count"]+">)")
+				} else if metricTypeOf(metric, m.MetricsType) == "boolean" {
+					value = parseBoolean(rawValue, m.TrueValues)
+				} else if mappedValue, ok := m.ValueMap[metric][strings.TrimSpace(rawValue)]; ok {
+					value = mappedValue
+				} else if value, err = strconv.ParseFloat(strings.TrimSpace(rawValue), 64); err != nil {
+					// If not a float, skip current metric
+					if _, ok := m.ValueMap[metric]; ok {
+						e.logUnmappedValue(m.Context, metric, rawValue)
 						continue
 					}
-					buckets := make(map[float64]uint64)
-					for field, le := range metricsBuckets[metric] {
-						lelimit, err := strconv.ParseFloat(strings.TrimSpace(le), 64)
-						if err != nil {
-							level.Error(e.logger).Log("msg", "Unable to convert bucket limit value to float (metric="+metric+
-								",metricHelp="+metricHelp+",bucketlimit=<"+le+">)")
-							continue
-						}
-						counter, err := strconv.ParseUint(strings.TrimSpace(row[field]), 10, 64)
-						if err != nil {
-							level.Error(e.logger).Log("msg", "Unable to convert ", field, " value to int (metric="+metric+
-								",metricHelp="+metricHelp+",value=<"+row[field]+">)")
-							continue
-						}
-						buckets[lelimit] = counter
-					}
-					ch <- prometheus.MustNewConstHistogram(desc, count, value, buckets)
+					level.Error(e.logger).Log("msg", "Unable to convert current value to float (metric="+metric+
+						",metricHelp="+metricHelp+",value=<"+rawValue+">)")
+					continue
+				} else if imprecise = isImprecise(rawValue, value); imprecise {
+					e.logImpreciseValue(m.Context, metric, rawValue)
+				}
+			} else if metricTypeOf(metric, m.MetricsType) == "boolean" && resultColumns[metric] {
+				// a boolean is false when NULL, e.g. when a health check finds nothing
+				value = 0
+			} else if metricTypeOf(metric, m.MetricsType) == "boolean" {
+				// rather than reporting false for a column the request doesn't return, e.g. because of a typo
+				e.logMissingColumn(m.Context, metric)
+				continue
+			} else if value, ok = e.nullValue(metric, metricHelp, m.NullValue); !ok {
+				// NULL values are skipped unless nullvalue says otherwise
+				continue
+			}
+			level.Debug(e.logger).Log("msg", "Query result",
+				"value", value)
+			if isDeltaColumn(metric, m.Delta) {
+				key := deltaPrefix + metric + "\xff" + row[m.FieldToAppend] + "\xff" + strings.Join(labelsValues, "\xff")
+				seenSeries[key] = true
+				delta, ok := e.delta(key, value)
+				if !ok {
+					metricsCount++
+					continue
+				}
+				value, valueType = delta, prometheus.GaugeValue
+			} else if isDeltaColumn(metric, m.Monotonic) {
+				key := deltaPrefix + metric + "\xff" + row[m.FieldToAppend] + "\xff" + strings.Join(labelsValues, "\xff")
+				seenSeries[key] = true
+				value = e.monotonic(key, value)
+			}
+			value = roundValue(value, m.Round)
+			// If metric do not use a field content in metric's name
+			fqName := fqNames[metric]
+			if strings.Compare(m.FieldToAppend, "") != 0 {
+				fqName = prometheus.BuildFQName(e.namespace, m.Context, cleanName(row[m.FieldToAppend]))
+			}
+			help := e.renderHelp(helpTemplates[metric], metricHelp, row)
+			desc := getDesc(fqName, help, labels)
+			var promMetric prometheus.Metric
+			switch metricTypeOf(metric, m.MetricsType) {
+			case "histogram":
+				// histograms keep their labels, as the appended field only names the metric
+				count, buckets, ok := e.parseHistogram(metric, metricHelp, row, m.MetricsBuckets[metric])
+				if !ok {
+					continue
+				}
+				promMetric, err = prometheus.NewConstHistogram(desc, count, value, buckets, labelsValues...)
+			case "summary":
+				count, quantiles, ok := e.parseSummary(metric, metricHelp, row, m.MetricsQuantiles[metric])
+				if !ok {
+					continue
+				}
+				promMetric, err = prometheus.NewConstSummary(desc, count, value, quantiles, labelsValues...)
+			default:
+				if strings.Compare(m.FieldToAppend, "") == 0 {
+					promMetric, err = prometheus.NewConstMetric(desc, valueType, value, labelsValues...)
 				} else {
-					ch <- prometheus.MustNewConstMetric(desc, getMetricType(metric, metricsType), value)
+					// If no labels, use metric name
+					desc = getDesc(fqName, help, nil)
+					promMetric, err = prometheus.NewConstMetric(desc, valueType, value)
+				}
+			}
+			if err != nil {
+				// e.g. an invalid metric or label name, skip it rather than panic
+				level.Error(e.logger).Log("msg", "Unable to create metric (metric="+fqName+
+					",metricHelp="+metricHelp+")", "error", err)
+				continue
+			}
+			send(promMetric)
+			if m.FlagImprecise {
+				// has the same labels as the metric, so that it can be joined to it
+				flagLabels, flagValues := labels, labelsValues
+				if strings.Compare(m.FieldToAppend, "") != 0 {
+					flagLabels, flagValues = nil, nil
+				}
+				flagDesc := getDesc(fqName+"_imprecise", "Whether the value of "+fqName+
+					" was too large to be represented exactly as a float64 (1 if so).", flagLabels)
+				flag := 0.0
+				if imprecise {
+					flag = 1
+				}
+				if flagMetric, err := prometheus.NewConstMetric(flagDesc, prometheus.GaugeValue, flag, flagValues...); err == nil {
+					send(flagMetric)
 				}
 			}
 			metricsCount++
@@ -631,12 +1913,65 @@ func (e *Exporter) scrapeGenericValues(db *sql.DB, ch chan<- prometheus.Metric,
 		return nil
 	}
 	level.Debug(e.logger).Log("msg", "Calling function GeneratePrometheusMetrics()")
-	err := e.generatePrometheusMetrics(db, genericParser, request, queryTimeout)
+	ctx, span := e.startSpan(ctx, m.Context)
+	span.SetAttribute("db.system", "oracle")
+	span.SetAttribute("db.query.text", e.redactSQL(m.Request))
+	span.SetAttribute("oracledb.query.timeout", queryTimeout.String())
+	started := time.Now()
+	// with an aggregate, the rows are grouped as they are read, and the aggregated rows are parsed once all have been read
+	parse := genericParser
+	var agg *aggregator
+	if m.Aggregate != "" {
+		agg = newAggregator(m)
+		parse = agg.add
+	}
+	ran, err := e.queryWithFallback(ctx, db, parse, columns, reuseRow, m, started, queryTimeout)
+	if err == nil && agg != nil {
+		for _, row := range agg.rows() {
+			if err = genericParser(row); err != nil {
+				break
+			}
+		}
+	}
+	span.SetAttribute("oracledb.query.rows", rowsCount)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
 	level.Debug(e.logger).Log("msg", "ScrapeGenericValues() - metricsCount: "+strconv.Itoa(metricsCount))
 	if err != nil {
 		return err
 	}
-	if !ignoreZeroResult && metricsCount == 0 {
+	for _, metric := range held {
+		ch <- metric
+	}
+	e.setLastScrapeTime(ran, started)
+	if rowsCount == 0 && m.EmitZeroRows && m.FieldToAppend == "" {
+		// the metrics are reported as zero rather than left out, so that they are not absent when there is nothing to count
+		if err := genericParser(zeroRow(m)); err != nil {
+			return err
+		}
+		// the zero row was not returned by the request
+		rowsCount = 0
+	}
+	if len(m.Delta) > 0 || len(m.Monotonic) > 0 {
+		e.pruneDeltas(deltaPrefix, seenSeries)
+	}
+	if rowsCount > 0 {
+		for metric := range m.MetricsDesc {
+			if !returned[metric] {
+				level.Warn(e.logger).Log("msg", "Field in metricsdesc was not returned by the request, or was NULL in every row",
+					"Context", m.Context,
+					"field", metric)
+			}
+		}
+	}
+	// only recorded once the query has run, so that no rows can be told apart from a failed query
+	e.scrapeRows.WithLabelValues(m.Context).Set(float64(rowsCount))
+	if metricTypeErr != nil {
+		return metricTypeErr
+	}
+	if !m.IgnoreZeroResult && metricsCount == 0 {
 		// a zero result error is returned for caller error identification.
 		// https://github.com/oracle/oracle-db-appdev-monitoring/issues/168
 		return newZeroResultError()
@@ -646,13 +1981,52 @@ func (e *Exporter) scrapeGenericValues(db *sql.DB, ch chan<- prometheus.Metric,
 
 // inspired by https://kylewbanks.com/blog/query-result-to-map-in-golang
 // Parse SQL result and call parsing function to each row
-func (e *Exporter) generatePrometheusMetrics(db *sql.DB, parse func(row map[string]string) error, query string, queryTimeout time.Duration) error {
-	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+// If maxRows is more than zero and the query returns more rows than that, no rows are parsed and an error is returned,
+// so that e.g. a fieldtoappend query that returns far more rows than expected doesn't create a metric per row.
+// If container is set, the query runs in that container (PDB) on a connection of its own.
+//
+// With reuseRow, the same map is passed to parse for every row, and each row is parsed as soon as it is read, so parse
+// must not keep the map. Rows are then not buffered to check maxRows, so the rows before the limit was passed are parsed,
+// and parse must hold what it makes of them until generatePrometheusMetrics has returned without an error.
+// If columns is not nil, it is called with the column names of the result before any row is parsed.
+func (e *Exporter) generatePrometheusMetrics(ctx context.Context, db Querier, parse func(row map[string]string) error, columns func(cols []string), reuseRow bool, query string, plsql bool, args []interface{}, queryTimeout time.Duration, maxRows int, container string) error {
+	var rows *sql.Rows
+	var err error
+	var conn *sql.Conn
+	if e.config.ConnectionWaitTimeout > 0 {
+		// the connection is taken from the pool with a deadline of its own, so that waiting for it isn't counted as query time
+		if conn, err = e.acquireConn(ctx, db); err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+	// the caller's context cancels the query on shutdown, as well as the query timeout
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
-	rows, err := db.QueryContext(ctx, query)
+	if conn == nil && (plsql || container != "") {
+		if conn, err = db.Conn(ctx); err != nil {
+			return err
+		}
+		// the connection must outlive the rows read from it
+		defer conn.Close()
+	}
+	if container != "" {
+		restore, err := e.setContainer(ctx, conn, container)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+	if plsql {
+		rows, err = queryRefCursor(ctx, conn, query, args)
+	} else if conn != nil {
+		rows, err = conn.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = db.QueryContext(ctx, query, args...)
+	}
 
 	if ctx.Err() == context.DeadlineExceeded {
-		return errors.New("Oracle query timed out")
+		return errQueryTimeout
 	}
 
 	if err != nil {
@@ -660,29 +2034,45 @@ func (e *Exporter) generatePrometheusMetrics(db *sql.DB, parse func(row map[stri
 	}
 	cols, err := rows.Columns()
 	defer rows.Close()
+	if columns != nil {
+		columns(cols)
+	}
 
-	for rows.Next() {
-		// Create a slice of interface{}'s to represent each column,
-		// and a second slice to contain pointers to each item in the columns slice.
-		columns := make([]interface{}, len(cols))
-		columnPointers := make([]interface{}, len(cols))
-		for i := range columns {
-			columnPointers[i] = &columns[i]
-		}
+	tooManyRows := func() error {
+		level.Warn(e.logger).Log("msg", "Query returned more than the maximum number of rows, skipping the metric. "+
+			"Check the request, or raise maxrows if this many rows are expected.",
+			"maxrows", maxRows,
+			"request", e.redactSQL(query))
+		return newMaxRowsError(maxRows)
+	}
 
-		// Scan the result into the column pointers...
-		if err := rows.Scan(columnPointers...); err != nil {
+	// with a row limit, the rows are only parsed once they are all read, so that none are used if there are too many
+	var buffered []map[string]string
+	scanner := newRowScanner(cols, reuseRow)
+	rowsRead := 0
+	for rows.Next() {
+		m, err := scanner.scan(rows)
+		if err != nil {
 			return err
 		}
-
-		// Create our map, and retrieve the value for each column from the pointers slice,
-		// storing it in the map with the name of the column as the key.
-		m := make(map[string]string)
-		for i, colName := range cols {
-			val := columnPointers[i].(*interface{})
-			m[strings.ToLower(colName)] = fmt.Sprintf("%v", *val)
+		rowsRead++
+		if maxRows > 0 && rowsRead > maxRows {
+			return tooManyRows()
+		}
+		if maxRows <= 0 || reuseRow {
+			// Call function to parse row
+			if err := parse(m); err != nil {
+				return err
+			}
+			continue
 		}
-		// Call function to parse row
+		buffered = append(buffered, m)
+	}
+	// an error while fetching rows would otherwise leave a partial result looking successful
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, m := range buffered {
 		if err := parse(m); err != nil {
 			return err
 		}
@@ -690,22 +2080,209 @@ func (e *Exporter) generatePrometheusMetrics(db *sql.DB, parse func(row map[stri
 	return nil
 }
 
-func getMetricType(metricType string, metricsType map[string]string) prometheus.ValueType {
+// queryWithFallback runs the request of a metric, and if it fails because a table or view does not exist,
+// e.g. on a database version that does not have the view, each of its fallback requests in turn until one runs.
+// It returns the metric with the request that was run last.
+func (e *Exporter) queryWithFallback(ctx context.Context, db Querier, parse func(row map[string]string) error, columns func(cols []string), reuseRow bool, m Metric, started time.Time, queryTimeout time.Duration) (Metric, error) {
+	requests := append([]string{m.Request}, m.RequestFallback...)
+	var err error
+	for i, request := range requests {
+		m.Request = request
+		query, args := e.incrementalRequest(m, started)
+		begun := time.Now()
+		err = e.generatePrometheusMetrics(e.withModuleAction(ctx, m.Context), db, parse, columns, reuseRow, query, m.PLSQL, args, queryTimeout, e.getMaxRows(m), m.Container)
+		e.logSlowQuery(m, query, time.Since(begun))
+		if err == nil || i == len(requests)-1 || !isTableNotFoundError(err) {
+			break
+		}
+		level.Debug(e.logger).Log("msg", "Request failed as a table or view does not exist, trying the next fallback request",
+			"Context", m.Context,
+			"fallback", i+1,
+			"error", err)
+	}
+	return m, err
+}
+
+// acquireConn takes a connection from the pool, waiting at most the connection wait timeout for one to be free
+func (e *Exporter) acquireConn(ctx context.Context, db Querier) (*sql.Conn, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, e.config.ConnectionWaitTimeout)
+	defer cancel()
+	conn, err := db.Conn(waitCtx)
+	if err != nil && ctx.Err() == nil && waitCtx.Err() == context.DeadlineExceeded {
+		var stats sql.DBStats
+		if pool, ok := db.(interface{ Stats() sql.DBStats }); ok {
+			stats = pool.Stats()
+		}
+		return nil, newConnectionWaitError(e.config.ConnectionWaitTimeout, stats.InUse, stats.MaxOpenConnections)
+	}
+	return conn, err
+}
+
+// maxActionLength is the maximum length of the action of a session set by dbms_application_info
+const maxActionLength = 32
+
+// withModuleAction returns a context that has godror set the module and action of the session to the exporter
+// and the metric context before the query runs. godror sets them along with the query, without a round trip of its own.
+func (e *Exporter) withModuleAction(ctx context.Context, metricContext string) context.Context {
+	if !e.config.SetModuleAction {
+		return ctx
+	}
+	action := metricContext
+	if len(action) > maxActionLength {
+		action = action[:maxActionLength]
+	}
+	return godror.ContextWithTraceTag(ctx, godror.TraceTag{Module: "oracledb_exporter", Action: action})
+}
+
+// rowScanner reads rows into maps keyed by the lower case column names, with the column buffers
+// allocated once for all rows. NULL columns are left out of the map.
+type rowScanner struct {
+	cols           []string
+	columns        []interface{}
+	columnPointers []interface{}
+	// row is the map returned for every row when it is reused, rather than a new one for each row
+	row map[string]string
+}
+
+func newRowScanner(cols []string, reuseRow bool) *rowScanner {
+	s := &rowScanner{
+		cols:           make([]string, len(cols)),
+		columns:        make([]interface{}, len(cols)),
+		columnPointers: make([]interface{}, len(cols)),
+	}
+	for i, colName := range cols {
+		s.cols[i] = strings.ToLower(colName)
+		s.columnPointers[i] = &s.columns[i]
+	}
+	if reuseRow {
+		s.row = make(map[string]string, len(cols))
+	}
+	return s
+}
+
+// scan reads the current row. If the row is reused, the map is only valid until the next call.
+func (s *rowScanner) scan(rows *sql.Rows) (map[string]string, error) {
+	if err := rows.Scan(s.columnPointers...); err != nil {
+		return nil, err
+	}
+	m := s.row
+	if m == nil {
+		m = make(map[string]string, len(s.cols))
+	} else {
+		clear(m)
+	}
+	for i, colName := range s.cols {
+		if s.columns[i] == nil {
+			continue
+		}
+		value, err := columnToString(s.columns[i])
+		if err != nil {
+			return nil, err
+		}
+		m[colName] = value
+	}
+	return m, nil
+}
+
+// columnToString converts a column value to a string. RAW and BLOB columns, which are returned as
+// []byte, are read as text, as are LOBs returned as a godror.Lob reader. Other types use their default format.
+func columnToString(val interface{}) (string, error) {
+	switch v := val.(type) {
+	case []byte:
+		return string(v), nil
+	case io.Reader:
+		b, err := io.ReadAll(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return fmt.Sprintf("%v", v), nil
+	}
+}
+
+// numericCharactersSQL sets the decimal and group separators to the ones strconv.ParseFloat expects
+const numericCharactersSQL = "ALTER SESSION SET NLS_NUMERIC_CHARACTERS = '.,'"
+
+// refreshToken is called by godror when the access token of the connection pool has expired, to get a new one
+func (e *Exporter) refreshToken(ctx context.Context, accessToken *dsn.AccessToken) error {
+	token, privateKey, err := e.config.TokenProvider.GetToken(ctx)
+	if err != nil {
+		level.Error(e.logger).Log("msg", "Unable to refresh the database access token", "error", err)
+		return err
+	}
+	level.Debug(e.logger).Log("msg", "Refreshed the database access token")
+	accessToken.Token, accessToken.PrivateKey = token, privateKey
+	return nil
+}
+
+// sessionInit returns a godror OnInit callback that runs the statements, e.g. ALTER SESSION SET NLS_DATE_FORMAT=...,
+// on a new connection before it is used
+func sessionInit(stmts []string) func(context.Context, driver.ConnPrepareContext) error {
+	return func(ctx context.Context, conn driver.ConnPrepareContext) error {
+		for _, qry := range stmts {
+			st, err := conn.PrepareContext(ctx, qry)
+			if err != nil {
+				return fmt.Errorf("%s: %w", qry, err)
+			}
+			_, err = st.(driver.StmtExecContext).ExecContext(ctx, nil)
+			st.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", qry, err)
+			}
+		}
+		return nil
+	}
+}
+
+// queryRefCursor runs a PL/SQL block that opens a ref cursor in the :refcursor OUT bind variable, and returns
+// the rows of the cursor. The connection must not be closed before the rows.
+func queryRefCursor(ctx context.Context, conn *sql.Conn, query string, args []interface{}) (*sql.Rows, error) {
+	var rset driver.Rows
+	args = append(args, sql.Named("refcursor", sql.Out{Dest: &rset}))
+	if _, err := conn.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+	rows, err := godror.WrapRows(ctx, conn, rset)
+	if err != nil {
+		rset.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// getMetricType returns the prometheus value type configured for a metric, defaulting to gauge,
+// or an error if the configured type is not known.
+func getMetricType(metricType string, metricsType map[string]string) (prometheus.ValueType, error) {
 	var strToPromType = map[string]prometheus.ValueType{
 		"gauge":     prometheus.GaugeValue,
 		"counter":   prometheus.CounterValue,
 		"histogram": prometheus.UntypedValue,
+		"summary":   prometheus.UntypedValue,
+		"timestamp": prometheus.GaugeValue,
+		"info":      prometheus.GaugeValue,
+		"boolean":   prometheus.GaugeValue,
 	}
 
-	strType, ok := metricsType[strings.ToLower(metricType)]
+	strType := metricTypeOf(metricType, metricsType)
+	valueType, ok := strToPromType[strType]
 	if !ok {
-		return prometheus.GaugeValue
+		return prometheus.UntypedValue, errors.New("Error while getting prometheus type " + strType)
 	}
-	valueType, ok := strToPromType[strings.ToLower(strType)]
-	if !ok {
-		panic(errors.New("Error while getting prometheus type " + strings.ToLower(strType)))
+	return valueType, nil
+}
+
+// metricTypeOf returns the type configured for a metric in metricstype, in lower case and trimmed, defaulting to gauge.
+// The metric is looked up regardless of case, so that e.g. MetricsType = { "MyVal" = "Histogram" } makes the
+// myval column a histogram wherever the type is checked.
+func metricTypeOf(metric string, metricsType map[string]string) string {
+	metric = strings.ToLower(strings.TrimSpace(metric))
+	for column, metricType := range metricsType {
+		if strings.ToLower(strings.TrimSpace(column)) == metric {
+			return strings.ToLower(strings.TrimSpace(metricType))
+		}
 	}
-	return valueType
+	return "gauge"
 }
 
 func cleanName(s string) string {
@@ -715,9 +2292,15 @@ func cleanName(s string) string {
 	s = strings.Replace(s, "/", "", -1)  // Remove forward slashes
 	s = strings.Replace(s, "*", "", -1)  // Remove asterisks
 	s = strings.ToLower(s)
+	s = invalidNameChars.ReplaceAllString(s, "_") // Replace anything else not valid in a metric name
+	if len(s) > 0 && s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s // Names cannot start with a digit
+	}
 	return s
 }
 
+var invalidNameChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
 func (e *Exporter) logError(s string) {
 	_ = level.Error(e.logger).Log(s)
 }
@@ -0,0 +1,1179 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestExporter creates an Exporter that is not connected to a database, with the default configuration
+// changed by configure
+func newTestExporter(t testing.TB, configure func(cfg *Config)) *Exporter {
+	t.Helper()
+	cfg := CreateDefaultConfig()
+	if configure != nil {
+		configure(cfg)
+	}
+	e, err := newExporter(log.NewNopLogger(), cfg)
+	if err != nil {
+		t.Fatalf("newExporter: %v", err)
+	}
+	return e
+}
+
+// collected is a collector of the metrics emitted by a scrape, to compare them with testutil
+type collected []prometheus.Metric
+
+func (c collected) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c collected) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c {
+		ch <- m
+	}
+}
+
+// mockRows returns the rows of a result with the given columns, as go-sqlmock returns them
+func mockRows(columns []string, rows ...[]driver.Value) *sqlmock.Rows {
+	r := sqlmock.NewRows(columns)
+	for _, row := range rows {
+		r.AddRow(row...)
+	}
+	return r
+}
+
+// collectRows scrapes a metric whose request returns the given rows, and returns the metrics it emits
+func collectRows(t *testing.T, m Metric, columns []string, rows ...[]driver.Value) (collected, error) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(m.Request).WillReturnRows(mockRows(columns, rows...))
+	metrics, err := CollectMetric(context.Background(), db, m)
+	return collected(metrics), err
+}
+
+// assertMetrics fails the test if the metrics are not the ones in the text exposition format
+func assertMetrics(t *testing.T, metrics collected, want string) {
+	t.Helper()
+	if err := testutil.CollectAndCompare(metrics, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnectionParamsWallet(t *testing.T) {
+	tests := []struct {
+		name              string
+		cfg               Config
+		wantConfigDir     string
+		wantConnectString string
+		wantExternalAuth  bool
+	}{
+		{
+			name:              "no wallet",
+			cfg:               Config{User: "system", Password: "secret", ConnectString: "db:1521/ORCLPDB1"},
+			wantConnectString: "db:1521/ORCLPDB1",
+		},
+		{
+			name:              "wallet is the config dir without TNS_ADMIN",
+			cfg:               Config{User: "system", Password: "secret", ConnectString: "mydb_high", WalletLocation: "/wallet"},
+			wantConfigDir:     "/wallet",
+			wantConnectString: "mydb_high",
+		},
+		{
+			name:              "TNS_ADMIN takes precedence over the wallet",
+			cfg:               Config{User: "system", Password: "secret", ConnectString: "mydb_high", ConfigDir: "/tns", WalletLocation: "/wallet"},
+			wantConfigDir:     "/tns",
+			wantConnectString: "mydb_high",
+		},
+		{
+			name:              "tcps connect string is told where the wallet is",
+			cfg:               Config{User: "system", Password: "secret", ConnectString: "tcps://db:2484/ORCLPDB1", WalletLocation: "/wallet"},
+			wantConfigDir:     "/wallet",
+			wantConnectString: "tcps://db:2484/ORCLPDB1?wallet_location=/wallet",
+		},
+		{
+			name:              "tcps connect string with parameters",
+			cfg:               Config{User: "system", Password: "secret", ConnectString: "tcps://db:2484/ORCLPDB1?ssl_server_dn_match=yes", WalletLocation: "/wallet"},
+			wantConfigDir:     "/wallet",
+			wantConnectString: "tcps://db:2484/ORCLPDB1?ssl_server_dn_match=yes&wallet_location=/wallet",
+		},
+		{
+			name:              "tcps connect string with its own wallet location",
+			cfg:               Config{User: "system", Password: "secret", ConnectString: "tcps://db:2484/ORCLPDB1?wallet_location=/other", WalletLocation: "/wallet"},
+			wantConfigDir:     "/wallet",
+			wantConnectString: "tcps://db:2484/ORCLPDB1?wallet_location=/other",
+		},
+		{
+			name:              "wallet without a password uses external authentication",
+			cfg:               Config{User: "system", ConnectString: "mydb_high", WalletLocation: "/wallet"},
+			wantConfigDir:     "/wallet",
+			wantConnectString: "mydb_high",
+			wantExternalAuth:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestExporter(t, func(cfg *Config) {
+				cfg.User, cfg.Password, cfg.ConnectString = tt.cfg.User, tt.cfg.Password, tt.cfg.ConnectString
+				cfg.ConfigDir, cfg.WalletLocation = tt.cfg.ConfigDir, tt.cfg.WalletLocation
+			})
+			P, err := e.connectionParams()
+			if err != nil {
+				t.Fatalf("connectionParams: %v", err)
+			}
+			if P.ConfigDir != tt.wantConfigDir {
+				t.Errorf("ConfigDir = %q, want %q", P.ConfigDir, tt.wantConfigDir)
+			}
+			if P.ConnectString != tt.wantConnectString {
+				t.Errorf("ConnectString = %q, want %q", P.ConnectString, tt.wantConnectString)
+			}
+			if P.ExternalAuth.Bool != tt.wantExternalAuth {
+				t.Errorf("ExternalAuth = %v, want %v", P.ExternalAuth.Bool, tt.wantExternalAuth)
+			}
+			if tt.wantExternalAuth && P.Username != "" {
+				t.Errorf("Username = %q, want no user with external authentication", P.Username)
+			}
+		})
+	}
+}
+
+func TestMaskDsn(t *testing.T) {
+	tests := map[string]string{
+		"db:1521/ORCLPDB1":                      "db:1521/ORCLPDB1",
+		"tcps://db:2484/ORCLPDB1":               "tcps://db:2484/ORCLPDB1",
+		"system/secret@db:1521/ORCLPDB1":        "***@db:1521/ORCLPDB1",
+		"system/secret@tcps://db:2484/ORCLPDB1": "***@tcps://db:2484/ORCLPDB1",
+	}
+	for dsn, want := range tests {
+		if got := maskDsn(dsn); got != want {
+			t.Errorf("maskDsn(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
+
+func TestHistogramWithFieldToAppendKeepsLabels(t *testing.T) {
+	m := Metric{
+		Context:        "query",
+		Labels:         []string{"sql_id"},
+		FieldToAppend:  "name",
+		MetricsDesc:    map[string]string{"time": "Elapsed time of the query."},
+		MetricsType:    map[string]string{"time": "histogram"},
+		MetricsBuckets: map[string]map[string]string{"time": {"le_1": "1", "le_10": "10"}},
+		Request:        "select name, sql_id, time, count, le_1, le_10 from query_times",
+	}
+	metrics, err := collectRows(t, m, []string{"NAME", "SQL_ID", "TIME", "COUNT", "LE_1", "LE_10"},
+		[]driver.Value{"elapsed", "abc", 12.5, 5, 2, 4},
+		[]driver.Value{"elapsed", "def", 3, 1, 1, 1},
+	)
+	if err != nil {
+		t.Fatalf("CollectMetric: %v", err)
+	}
+	assertMetrics(t, metrics, `
+# HELP oracledb_query_elapsed Elapsed time of the query.
+# TYPE oracledb_query_elapsed histogram
+oracledb_query_elapsed_bucket{sql_id="abc",le="1"} 2
+oracledb_query_elapsed_bucket{sql_id="abc",le="10"} 4
+oracledb_query_elapsed_bucket{sql_id="abc",le="+Inf"} 5
+oracledb_query_elapsed_sum{sql_id="abc"} 12.5
+oracledb_query_elapsed_count{sql_id="abc"} 5
+oracledb_query_elapsed_bucket{sql_id="def",le="1"} 1
+oracledb_query_elapsed_bucket{sql_id="def",le="10"} 1
+oracledb_query_elapsed_bucket{sql_id="def",le="+Inf"} 1
+oracledb_query_elapsed_sum{sql_id="def"} 3
+oracledb_query_elapsed_count{sql_id="def"} 1
+`)
+}
+
+func TestNullValues(t *testing.T) {
+	// a NULL label column is an empty label, while a NULL value column is handled as nullvalue says
+	rows := [][]driver.Value{{"ACTIVE", nil}, {"INACTIVE", 3}, {nil, 2}}
+	tests := []struct {
+		nullValue string
+		want      string
+	}{
+		{"", `
+oracledb_sessions_value{status="INACTIVE"} 3
+oracledb_sessions_value{status=""} 2
+`},
+		{"skip", `
+oracledb_sessions_value{status="INACTIVE"} 3
+oracledb_sessions_value{status=""} 2
+`},
+		{"zero", `
+oracledb_sessions_value{status="ACTIVE"} 0
+oracledb_sessions_value{status="INACTIVE"} 3
+oracledb_sessions_value{status=""} 2
+`},
+		{"nan", `
+oracledb_sessions_value{status="ACTIVE"} NaN
+oracledb_sessions_value{status="INACTIVE"} 3
+oracledb_sessions_value{status=""} 2
+`},
+	}
+	for _, tt := range tests {
+		name := tt.nullValue
+		if name == "" {
+			name = "default"
+		}
+		t.Run(name, func(t *testing.T) {
+			m := Metric{
+				Context:     "sessions",
+				Labels:      []string{"status"},
+				MetricsDesc: map[string]string{"value": "Number of sessions."},
+				NullValue:   tt.nullValue,
+				Request:     "select status, count(*) as value from v$session group by status",
+			}
+			metrics, err := collectRows(t, m, []string{"STATUS", "VALUE"}, rows...)
+			if err != nil {
+				t.Fatalf("CollectMetric: %v", err)
+			}
+			assertMetrics(t, metrics, `
+# HELP oracledb_sessions_value Number of sessions.
+# TYPE oracledb_sessions_value gauge`+tt.want)
+		})
+	}
+}
+
+func TestInvalidMetricType(t *testing.T) {
+	if _, err := getMetricType("value", map[string]string{"value": "guage"}); err == nil {
+		t.Error("getMetricType accepted guage")
+	}
+
+	m := Metric{
+		Context:     "sessions",
+		MetricsDesc: map[string]string{"value": "Number of sessions."},
+		MetricsType: map[string]string{"value": "guage"},
+		Request:     "select count(*) as value from v$session",
+	}
+	if _, err := collectRows(t, m, []string{"VALUE"}, []driver.Value{3}); err == nil {
+		t.Error("CollectMetric accepted a metric with an invalid type")
+	}
+
+	// a metric file that was not validated, e.g. loaded by an older version, is skipped with an error rather than panicking
+	e := newTestExporter(t, nil)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(m.Request).WillReturnRows(mockRows([]string{"VALUE"}, []driver.Value{3}))
+	ch := make(chan prometheus.Metric, 1)
+	if err := e.scrapeGenericValues(context.Background(), db, ch, m, time.Second); err == nil {
+		t.Error("scrapeGenericValues returned no error for a metric with an invalid type")
+	}
+	if len(ch) != 0 {
+		t.Errorf("scrapeGenericValues emitted %d metrics, want none", len(ch))
+	}
+}
+
+func TestGetQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		queryTimeout string
+		want         time.Duration
+		wantWarning  bool
+	}{
+		{"metric timeout takes precedence", "2m", 2 * time.Minute, false},
+		{"metric timeout can be shorter than the global one", "500ms", 500 * time.Millisecond, false},
+		{"global timeout when not set", "", 5 * time.Second, false},
+		{"global timeout with a warning when malformed", "2 minutes", 5 * time.Second, true},
+		{"global timeout with a warning when not positive", "0s", 5 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			e := newTestExporter(t, func(cfg *Config) { cfg.QueryTimeout = 5 })
+			e.logger = log.NewLogfmtLogger(&logs)
+			got := e.getQueryTimeout(Metric{Context: "awr", QueryTimeout: tt.queryTimeout})
+			if got != tt.want {
+				t.Errorf("getQueryTimeout() = %v, want %v", got, tt.want)
+			}
+			if warned := strings.Contains(logs.String(), "Invalid querytimeout"); warned != tt.wantWarning {
+				t.Errorf("warning logged = %v, want %v: %s", warned, tt.wantWarning, logs.String())
+			}
+		})
+	}
+}
+
+func TestRawColumnLabel(t *testing.T) {
+	m := Metric{
+		Context:     "segment",
+		Labels:      []string{"guid"},
+		MetricsDesc: map[string]string{"bytes": "Size of the segment."},
+		Request:     "select guid, bytes from segments",
+	}
+	// a RAW column is returned as []byte, which must not be formatted as a list of numbers
+	metrics, err := collectRows(t, m, []string{"GUID", "BYTES"}, []driver.Value{[]byte("0A1B2C"), 1024})
+	if err != nil {
+		t.Fatalf("CollectMetric: %v", err)
+	}
+	assertMetrics(t, metrics, `
+# HELP oracledb_segment_bytes Size of the segment.
+# TYPE oracledb_segment_bytes gauge
+oracledb_segment_bytes{guid="0A1B2C"} 1024
+`)
+}
+
+func TestColumnToString(t *testing.T) {
+	tests := []struct {
+		name string
+		val  interface{}
+		want string
+	}{
+		{"raw", []byte("hi"), "hi"},
+		{"lob", strings.NewReader("a long text"), "a long text"},
+		{"int", int64(42), "42"},
+		{"float", 1.5, "1.5"},
+		{"string", "ACTIVE", "ACTIVE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := columnToString(tt.val)
+			if err != nil {
+				t.Fatalf("columnToString: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("columnToString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConcurrentScheduledScrapes collects while scheduled scrapes run and their interval changes, so that
+// go test -race finds unsynchronized access to the results and the scrape interval
+func TestConcurrentScheduledScrapes(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	m := Metric{
+		Context:     "sessions",
+		MetricsDesc: map[string]string{"value": "Number of sessions."},
+		Request:     "select count(*) as value from v$session",
+	}
+	for i := 0; i < 1000; i++ {
+		mock.ExpectQuery(m.Request).WillReturnRows(mockRows([]string{"VALUE"}, []driver.Value{i}))
+	}
+
+	cfg := CreateDefaultConfig()
+	// pinged, which go-sqlmock allows without an expectation
+	cfg.HealthCheckQuery = ""
+	e, err := NewExporterWithDB(log.NewNopLogger(), cfg, db)
+	if err != nil {
+		t.Fatalf("NewExporterWithDB: %v", err)
+	}
+	e.mu.Lock()
+	e.metricsToScrape = Metrics{Metric: []Metric{m}}
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.RunScheduledScrapes(ctx, 2*time.Millisecond)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			testutil.CollectAndCount(e)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			// fails until the scheduled scrapes have started
+			_ = e.SetScrapeInterval(time.Duration(1+i%3) * time.Millisecond)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	wg.Wait()
+
+	// a scheduled scrape has completed by now, and its results are served
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.CollectAndCount(e, "oracledb_sessions_value") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the results of the scheduled scrapes were not collected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	// waits for a scrape that is still running before the database is closed
+	e.mu.Lock()
+	e.mu.Unlock()
+}
+
+func TestScrapeCancelledWithContext(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	m := Metric{
+		Context:     "awr",
+		MetricsDesc: map[string]string{"value": "A slow query."},
+		Request:     "select count(*) as value from dba_hist_sqlstat",
+	}
+	mock.ExpectQuery(m.Request).
+		WillDelayFor(time.Minute).
+		WillReturnRows(mockRows([]string{"VALUE"}, []driver.Value{1}))
+
+	e := newTestExporter(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	started := time.Now()
+	err = e.scrapeGenericValues(ctx, db, make(chan prometheus.Metric, 1), m, time.Minute)
+	if !errors.Is(err, sqlmock.ErrCancelled) {
+		t.Errorf("scrapeGenericValues() error = %v, want the query to be cancelled", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("the scrape took %v after it was cancelled", elapsed)
+	}
+}
+
+func TestCheckIfMetricsChanged(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.toml"), filepath.Join(dir, "b.toml")
+	writeFile := func(file, content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(a, "# a")
+	writeFile(b, "# b")
+
+	e := newTestExporter(t, func(cfg *Config) { cfg.CustomMetrics = a + "," + b })
+	if !e.checkIfMetricsChanged() {
+		t.Error("the files were not detected the first time")
+	}
+	if e.checkIfMetricsChanged() {
+		t.Error("unchanged files were detected as changed")
+	}
+
+	// reordering the list must not change the hash each file is compared with
+	e.config.CustomMetrics = b + "," + a
+	if e.checkIfMetricsChanged() {
+		t.Error("reordered files were detected as changed")
+	}
+
+	writeFile(a, "# a, changed")
+	if !e.checkIfMetricsChanged() {
+		t.Error("the changed file was not detected after the list was reordered")
+	}
+
+	e.config.CustomMetrics = b
+	if !e.checkIfMetricsChanged() {
+		t.Error("the file removed from the list was not detected")
+	}
+	if e.checkIfMetricsChanged() {
+		t.Error("the remaining file was detected as changed")
+	}
+}
+
+func TestConnectionParamsProxyUser(t *testing.T) {
+	tests := []struct {
+		name             string
+		cfg              Config
+		wantUsername     string
+		wantPassword     string
+		wantExternalAuth bool
+	}{
+		{
+			name:         "password",
+			cfg:          Config{User: "app", Password: "secret", ConnectString: "db"},
+			wantUsername: "app",
+			wantPassword: "secret",
+		},
+		{
+			name:         "proxy into the monitoring schema",
+			cfg:          Config{User: "app", Password: "secret", ProxyUser: "monitor", ConnectString: "db"},
+			wantUsername: "app[monitor]",
+			wantPassword: "secret",
+		},
+		{
+			name:             "external authentication into the monitoring schema",
+			cfg:              Config{ProxyUser: "monitor", ConnectString: "db"},
+			wantUsername:     "[monitor]",
+			wantExternalAuth: true,
+		},
+		{
+			name:             "forced external authentication keeps the user",
+			cfg:              Config{User: "app", ExternalAuth: true, ProxyUser: "monitor", ConnectString: "db"},
+			wantUsername:     "app[monitor]",
+			wantExternalAuth: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestExporter(t, func(cfg *Config) {
+				cfg.User, cfg.Password, cfg.ProxyUser = tt.cfg.User, tt.cfg.Password, tt.cfg.ProxyUser
+				cfg.ConnectString, cfg.ExternalAuth = tt.cfg.ConnectString, tt.cfg.ExternalAuth
+			})
+			P, err := e.connectionParams()
+			if err != nil {
+				t.Fatalf("connectionParams: %v", err)
+			}
+			if P.Username != tt.wantUsername {
+				t.Errorf("Username = %q, want %q", P.Username, tt.wantUsername)
+			}
+			if P.Password.Secret() != tt.wantPassword {
+				t.Errorf("Password = %q, want %q", P.Password.Secret(), tt.wantPassword)
+			}
+			if P.ExternalAuth.Bool != tt.wantExternalAuth {
+				t.Errorf("ExternalAuth = %v, want %v", P.ExternalAuth.Bool, tt.wantExternalAuth)
+			}
+		})
+	}
+}
+
+func TestMixedMetricTypes(t *testing.T) {
+	m := Metric{
+		Context: "sysstat",
+		MetricsDesc: map[string]string{
+			"User_Commits":   "Number of user commits.",
+			"Active_Session": "Number of active sessions.",
+		},
+		MetricsType: map[string]string{"user_commits": "counter", "ACTIVE_SESSION": "gauge"},
+		Request:     "select user_commits, active_session from sysstat",
+	}
+	metrics, err := collectRows(t, m, []string{"USER_COMMITS", "ACTIVE_SESSION"}, []driver.Value{1200, 7})
+	if err != nil {
+		t.Fatalf("CollectMetric: %v", err)
+	}
+	assertMetrics(t, metrics, `
+# HELP oracledb_sysstat_active_session Number of active sessions.
+# TYPE oracledb_sysstat_active_session gauge
+oracledb_sysstat_active_session 7
+# HELP oracledb_sysstat_user_commits Number of user commits.
+# TYPE oracledb_sysstat_user_commits counter
+oracledb_sysstat_user_commits 1200
+`)
+}
+
+func TestMetricsDescColumnNotReturned(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	metrics := []Metric{{
+		Context:     "sysstat",
+		MetricsDesc: map[string]string{"user_commits": "Number of user commits.", "user_rollbacks": "Number of user rollbacks."},
+		MetricsType: map[string]string{"user_commits": "counter", "user_rollbacks": "counter"},
+		Request:     "select user_commits from sysstat",
+	}}
+	normalizeMetrics(metrics)
+	mock.ExpectQuery(metrics[0].Request).WillReturnRows(mockRows([]string{"USER_COMMITS"}, []driver.Value{1200}))
+
+	var logs bytes.Buffer
+	e := newTestExporter(t, nil)
+	e.logger = log.NewLogfmtLogger(&logs)
+	ch := make(chan prometheus.Metric, 2)
+	if err := e.scrapeGenericValues(context.Background(), db, ch, metrics[0], time.Second); err != nil {
+		t.Fatalf("scrapeGenericValues: %v", err)
+	}
+	if len(ch) != 1 {
+		t.Errorf("scrapeGenericValues emitted %d metrics, want 1", len(ch))
+	}
+	if !strings.Contains(logs.String(), "field=user_rollbacks") {
+		t.Errorf("the metricsdesc column the request does not return was not logged: %s", logs.String())
+	}
+}
+
+func TestUppercaseLabel(t *testing.T) {
+	m := Metric{
+		Context:     "sessions",
+		Labels:      []string{"STATUS", "Type"},
+		MetricsDesc: map[string]string{"value": "Number of sessions."},
+		Request:     "select status, type, count(*) as value from v$session group by status, type",
+	}
+	metrics, err := collectRows(t, m, []string{"STATUS", "TYPE", "VALUE"}, []driver.Value{"ACTIVE", "USER", 3})
+	if err != nil {
+		t.Fatalf("CollectMetric: %v", err)
+	}
+	// the labels keep the case they were given, and are matched to the columns regardless of case
+	assertMetrics(t, metrics, `
+# HELP oracledb_sessions_value Number of sessions.
+# TYPE oracledb_sessions_value gauge
+oracledb_sessions_value{STATUS="ACTIVE",Type="USER"} 3
+`)
+}
+
+func TestMixedCaseMetricsType(t *testing.T) {
+	m := Metric{
+		Context:        "test",
+		MetricsDesc:    map[string]string{"MyVal": "A value given in mixed case."},
+		MetricsType:    map[string]string{"MyVal": "Histogram"},
+		MetricsBuckets: map[string]map[string]string{"MyVal": {"le_5": "5"}},
+		Request:        "select myval, count, le_5 from t",
+	}
+	metrics, err := collectRows(t, m, []string{"MYVAL", "COUNT", "LE_5"},
+		[]driver.Value{7, 3, 2},
+	)
+	if err != nil {
+		t.Fatalf("CollectMetric: %v", err)
+	}
+	assertMetrics(t, metrics, `
+# HELP oracledb_test_myval A value given in mixed case.
+# TYPE oracledb_test_myval histogram
+oracledb_test_myval_bucket{le="5"} 2
+oracledb_test_myval_bucket{le="+Inf"} 3
+oracledb_test_myval_sum 7
+oracledb_test_myval_count 3
+`)
+
+	if got := metricTypeOf(" myval ", map[string]string{"MyVal": " Histogram "}); got != "histogram" {
+		t.Errorf("metricTypeOf = %q, want %q", got, "histogram")
+	}
+	if got := metricTypeOf("other", map[string]string{"MyVal": "histogram"}); got != "gauge" {
+		t.Errorf("metricTypeOf = %q, want %q", got, "gauge")
+	}
+}
+
+func TestCommaDecimalSeparator(t *testing.T) {
+	e := newTestExporter(t, func(cfg *Config) {
+		cfg.User, cfg.Password, cfg.ConnectString = "app", "secret", "db"
+		cfg.SessionInitSQL = []string{"ALTER SESSION SET NLS_TERRITORY = 'GERMANY'"}
+	})
+	P, err := e.connectionParams()
+	if err != nil {
+		t.Fatalf("connectionParams: %v", err)
+	}
+
+	// the session is initialised with the separators strconv.ParseFloat expects before the configured statements
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectPrepare(numericCharactersSQL).ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("ALTER SESSION SET NLS_TERRITORY = 'GERMANY'").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("db.Conn: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Raw(func(dc any) error {
+		return P.OnInit(context.Background(), dc.(driver.ConnPrepareContext))
+	}); err != nil {
+		t.Fatalf("OnInit: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// a value still formatted with a comma is skipped rather than parsed as a different number
+	m := Metric{
+		Context:     "test",
+		MetricsDesc: map[string]string{"with_comma": "Formatted with a comma.", "with_point": "Formatted with a point."},
+		Request:     "select to_char(1234.56) with_comma, to_char(1234.56) with_point from dual",
+	}
+	metrics, err := collectRows(t, m, []string{"WITH_COMMA", "WITH_POINT"},
+		[]driver.Value{"1234,56", "1234.56"},
+	)
+	if err != nil {
+		t.Fatalf("CollectMetric: %v", err)
+	}
+	assertMetrics(t, metrics, `
+# HELP oracledb_test_with_point Formatted with a point.
+# TYPE oracledb_test_with_point gauge
+oracledb_test_with_point 1234.56
+`)
+}
+
+// benchmarkScrape scrapes a metric whose request returns the given rows b.N times. The mocked rows are set up
+// outside of the timer, so that only the scrape is measured.
+func benchmarkScrape(b *testing.B, m Metric, columns []string, rows [][]driver.Value) {
+	metrics := []Metric{m}
+	normalizeMetrics(metrics)
+	if errs := validateMetric(metrics[0]); len(errs) > 0 {
+		b.Fatal(errors.Join(errs...))
+	}
+	m = metrics[0]
+	e := newTestExporter(b, nil)
+	ch := make(chan prometheus.Metric)
+	go func() {
+		for range ch {
+		}
+	}()
+	defer close(ch)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			b.Fatalf("sqlmock.New: %v", err)
+		}
+		mock.ExpectQuery(m.Request).WillReturnRows(mockRows(columns, rows...))
+		b.StartTimer()
+		if err := e.scrapeGenericValues(context.Background(), db, ch, m, time.Minute); err != nil {
+			b.Fatalf("scrapeGenericValues: %v", err)
+		}
+		b.StopTimer()
+		db.Close()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkScrapeDescCache(b *testing.B) {
+	rows := make([][]driver.Value, 10000)
+	for i := range rows {
+		rows[i] = []driver.Value{fmt.Sprintf("event %d", i%100), fmt.Sprintf("class %d", i%10), i, i * 2}
+	}
+	columns := []string{"EVENT", "WAIT_CLASS", "TOTAL_WAITS", "TIME_WAITED"}
+	b.Run("labels", func(b *testing.B) {
+		benchmarkScrape(b, Metric{
+			Context:     "wait_time",
+			Labels:      []string{"event", "wait_class"},
+			MetricsDesc: map[string]string{"total_waits": "Number of waits.", "time_waited": "Time waited."},
+			Request:     "select event, wait_class, total_waits, time_waited from v$system_event",
+		}, columns, rows)
+	})
+	b.Run("fieldtoappend", func(b *testing.B) {
+		benchmarkScrape(b, Metric{
+			Context:       "wait_time",
+			Labels:        []string{"event"},
+			FieldToAppend: "wait_class",
+			MetricsDesc:   map[string]string{"total_waits": "Number of waits.", "time_waited": "Time waited."},
+			Request:       "select event, wait_class, total_waits, time_waited from v$system_event",
+		}, columns, rows)
+	})
+}
+
+func TestAggregator(t *testing.T) {
+	// a NULL column is left out of the row; host c only has NULL values
+	rows := []map[string]string{
+		{"host": "a", "v": "1"},
+		{"host": "b", "v": "2"},
+		{"host": "a", "v": "4"},
+		{"host": "a"},
+		{"host": "a", "v": "n/a"},
+		{"host": "c"},
+		{"host": "a", "v": "-3"},
+	}
+	tests := []struct {
+		aggregate string
+		want      []map[string]string
+	}{
+		{"sum", []map[string]string{{"host": "a", "v": "2"}, {"host": "b", "v": "2"}, {"host": "c"}}},
+		{"max", []map[string]string{{"host": "a", "v": "4"}, {"host": "b", "v": "2"}, {"host": "c"}}},
+		{"min", []map[string]string{{"host": "a", "v": "-3"}, {"host": "b", "v": "2"}, {"host": "c"}}},
+		{"avg", []map[string]string{{"host": "a", "v": "0.6666666666666666"}, {"host": "b", "v": "2"}, {"host": "c"}}},
+		{"count", []map[string]string{{"host": "a", "v": "3"}, {"host": "b", "v": "1"}, {"host": "c", "v": "0"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.aggregate, func(t *testing.T) {
+			agg := newAggregator(Metric{
+				Labels:      []string{"host"},
+				MetricsDesc: map[string]string{"v": "A value."},
+				Aggregate:   tt.aggregate,
+			})
+			for _, row := range rows {
+				if err := agg.add(row); err != nil {
+					t.Fatalf("add: %v", err)
+				}
+			}
+			if got := agg.rows(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) float64 {
+		return float64(time.Date(year, month, day, hour, min, sec, nsec, loc).UnixNano()) / float64(time.Second)
+	}
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("time zone database: %v", err)
+	}
+	tests := []struct {
+		name       string
+		value      string
+		timezone   string
+		dateFormat string
+		want       float64
+		wantErr    bool
+	}{
+		{name: "time.Time", value: "2025-10-16 13:14:15.5 +0000 UTC", want: date(2025, time.October, 16, 13, 14, 15, 5e8, time.UTC)},
+		{name: "RFC 3339", value: "2025-10-16T13:14:15+02:00", want: date(2025, time.October, 16, 11, 14, 15, 0, time.UTC)},
+		{name: "ISO 8601", value: "2025-10-16T13:14:15.123", want: date(2025, time.October, 16, 13, 14, 15, 123e6, time.UTC)},
+		{name: "ISO 8601 with a space", value: "2025-10-16 13:14:15", want: date(2025, time.October, 16, 13, 14, 15, 0, time.UTC)},
+		{name: "ISO 8601 date", value: "2025-10-16", want: date(2025, time.October, 16, 0, 0, 0, 0, time.UTC)},
+		{name: "DD-MON-RR HH.MI.SSXFF AM", value: "16-OCT-25 01.14.15.000000 PM", want: date(2025, time.October, 16, 13, 14, 15, 0, time.UTC)},
+		{name: "DD-MON-RR", value: "16-OCT-25", want: date(2025, time.October, 16, 0, 0, 0, 0, time.UTC)},
+		{name: "DD-MON-YYYY HH24:MI:SS", value: "16-Oct-2025 13:14:15", want: date(2025, time.October, 16, 13, 14, 15, 0, time.UTC)},
+		{name: "DD-MON-YYYY", value: " 16-oct-2025 ", want: date(2025, time.October, 16, 0, 0, 0, 0, time.UTC)},
+		{name: "timezone", value: "2025-10-16 13:14:15", timezone: "Europe/London", want: date(2025, time.October, 16, 13, 14, 15, 0, london)},
+		{name: "dateformat", value: "16/10/2025 13:14", dateFormat: "02/01/2006 15:04", want: date(2025, time.October, 16, 13, 14, 0, 0, time.UTC)},
+		{name: "dateformat is tried before the defaults", value: "2025-03-04", dateFormat: "2006-02-01", want: date(2025, time.April, 3, 0, 0, 0, 0, time.UTC)},
+		{name: "defaults are tried after dateformat", value: "16-OCT-25", dateFormat: "02/01/2006", want: date(2025, time.October, 16, 0, 0, 0, 0, time.UTC)},
+		{name: "not a date", value: "yesterday", wantErr: true},
+		{name: "unknown timezone", value: "2025-10-16", timezone: "Nowhere/Else", wantErr: true},
+	}
+	e := newTestExporter(t, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.parseTimestamp("m", "help", tt.value, tt.timezone, tt.dateFormat)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseTimestamp(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTimestamp(%q): %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseTimestamp(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDateFormat(t *testing.T) {
+	tests := []struct {
+		dateFormat string
+		valid      bool
+	}{
+		{"02-Jan-06 15:04:05", true},
+		{"2006-01-02", true},
+		{"15:04", true},
+		{"DD-MON-YY", false},
+		{"yyyy-mm-dd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dateFormat, func(t *testing.T) {
+			errs := validateMetric(Metric{
+				Context:     "test",
+				MetricsDesc: map[string]string{"started": "Start time."},
+				MetricsType: map[string]string{"started": "timestamp"},
+				DateFormat:  tt.dateFormat,
+				Request:     "select started from t",
+			})
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Errorf("validateMetric with dateformat %q returned %v, want valid = %v", tt.dateFormat, errs, tt.valid)
+			}
+		})
+	}
+}
+
+func BenchmarkScrapeGenericValues(b *testing.B) {
+	rows := make([][]driver.Value, 50000)
+	for i := range rows {
+		rows[i] = []driver.Value{i, fmt.Sprintf("user%d", i%500), fmt.Sprintf("program%d", i%50), "ACTIVE", i % 1000, i * 3}
+	}
+	columns := []string{"SID", "USERNAME", "PROGRAM", "STATUS", "LAST_CALL_ET", "LOGICAL_READS"}
+	for _, streaming := range []bool{false, true} {
+		b.Run(fmt.Sprintf("streaming=%v", streaming), func(b *testing.B) {
+			benchmarkScrape(b, Metric{
+				Context:     "session",
+				Labels:      []string{"sid", "username", "program", "status"},
+				MetricsDesc: map[string]string{"last_call_et": "Seconds since the last call.", "logical_reads": "Logical reads of the session."},
+				Streaming:   streaming,
+				MaxRows:     len(rows),
+				Request:     "select sid, username, program, status, last_call_et, logical_reads from session_stats",
+			}, columns, rows)
+		})
+	}
+}
+
+// scrapeOnce scrapes a metric through the cache with a per request scrape, and returns the metrics sent
+func scrapeOnce(t *testing.T, e *Exporter, db Querier, m Metric) collected {
+	t.Helper()
+	var metrics collected
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+	}()
+	err := e.scrapeMetricOrCache(context.Background(), db, ch, m, nil)
+	close(ch)
+	<-done
+	if err != nil {
+		t.Fatalf("scrapeMetricOrCache: %v", err)
+	}
+	return metrics
+}
+
+// TestMetricsSharingContext checks that metrics with the same context keep their results between scrapes separately
+func TestMetricsSharingContext(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(m *Metric)
+	}{
+		{name: "cachettl", configure: func(m *Metric) { m.CacheTTL = "1h" }},
+		{name: "sampleevery", configure: func(m *Metric) { m.SampleEvery = 2 }},
+		{name: "scrapeinterval", configure: func(m *Metric) { m.ScrapeInterval = "1h" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer db.Close()
+			active := Metric{
+				Context:     "sessions",
+				MetricsDesc: map[string]string{"active": "Active sessions."},
+				Request:     "select count(*) as active from v$session where status = 'ACTIVE'",
+			}
+			inactive := Metric{
+				Context:     "sessions",
+				MetricsDesc: map[string]string{"inactive": "Inactive sessions."},
+				Request:     "select count(*) as inactive from v$session where status = 'INACTIVE'",
+			}
+			tt.configure(&active)
+			tt.configure(&inactive)
+			// each request runs on the first scrape only, and its own results are sent again on the second one
+			mock.ExpectQuery(active.Request).WillReturnRows(mockRows([]string{"ACTIVE"}, []driver.Value{3}))
+			mock.ExpectQuery(inactive.Request).WillReturnRows(mockRows([]string{"INACTIVE"}, []driver.Value{5}))
+
+			e := newTestExporter(t, nil)
+			for e.scrapeCount = 1; e.scrapeCount <= 2; e.scrapeCount++ {
+				assertMetrics(t, scrapeOnce(t, e, db, active), `
+# HELP oracledb_sessions_active Active sessions.
+# TYPE oracledb_sessions_active gauge
+oracledb_sessions_active 3
+`)
+				assertMetrics(t, scrapeOnce(t, e, db, inactive), `
+# HELP oracledb_sessions_inactive Inactive sessions.
+# TYPE oracledb_sessions_inactive gauge
+oracledb_sessions_inactive 5
+`)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestLastValuesSharingContext checks that when the scrapes fail, each metric sharing a context sends its own last results
+func TestLastValuesSharingContext(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	active := Metric{
+		Context:     "sessions",
+		MetricsDesc: map[string]string{"active": "Active sessions."},
+		Request:     "select count(*) as active from v$session where status = 'ACTIVE'",
+	}
+	inactive := Metric{
+		Context:     "sessions",
+		MetricsDesc: map[string]string{"inactive": "Inactive sessions."},
+		Request:     "select count(*) as inactive from v$session where status = 'INACTIVE'",
+	}
+	outage := errors.New("ORA-03113: end-of-file on communication channel")
+	mock.ExpectQuery(active.Request).WillReturnRows(mockRows([]string{"ACTIVE"}, []driver.Value{3}))
+	mock.ExpectQuery(inactive.Request).WillReturnRows(mockRows([]string{"INACTIVE"}, []driver.Value{5}))
+	mock.ExpectQuery(active.Request).WillReturnError(outage)
+	mock.ExpectQuery(inactive.Request).WillReturnError(outage)
+
+	e := newTestExporter(t, func(cfg *Config) { cfg.EmitLastValueOnFailure = true })
+	e.metricsToScrape = Metrics{Metric: []Metric{active, inactive}}
+	scrape := func(send func(ch chan<- prometheus.Metric)) collected {
+		var metrics collected
+		ch := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for metric := range ch {
+				metrics = append(metrics, metric)
+			}
+		}()
+		send(ch)
+		close(ch)
+		<-done
+		return metrics
+	}
+	scrapeBoth := func(ch chan<- prometheus.Metric) {
+		for _, m := range []Metric{active, inactive} {
+			_ = e.scrapeWithLastValue(m, ch, func(ch chan<- prometheus.Metric) error {
+				return e.scrapeMetricOrCache(context.Background(), db, ch, m, nil)
+			})
+		}
+	}
+	want := `
+# HELP oracledb_sessions_active Active sessions.
+# TYPE oracledb_sessions_active gauge
+oracledb_sessions_active 3
+# HELP oracledb_sessions_inactive Inactive sessions.
+# TYPE oracledb_sessions_inactive gauge
+oracledb_sessions_inactive 5
+`
+	assertMetrics(t, scrape(scrapeBoth), want)
+	// the requests fail
+	assertMetrics(t, scrape(scrapeBoth), want)
+	// the database is down
+	assertMetrics(t, scrape(e.sendLastValues), want)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReconnectSettings(t *testing.T) {
+	for _, retries := range []int{-1, maxReconnectRetries + 1} {
+		if _, err := newExporter(log.NewNopLogger(), &Config{ReconnectMaxRetries: retries, ReconnectBackoff: time.Second}); err == nil {
+			t.Errorf("newExporter accepted a reconnect max retries of %d", retries)
+		}
+	}
+	if _, err := newExporter(log.NewNopLogger(), &Config{ReconnectMaxRetries: 3, ReconnectBackoff: -time.Second}); err == nil {
+		t.Error("newExporter accepted a negative reconnect backoff")
+	}
+
+	tests := []struct {
+		name     string
+		backoff  time.Duration
+		retries  int
+		failures int
+		want     time.Duration
+	}{
+		{name: "first failure", backoff: time.Second, retries: 3, failures: 0, want: time.Second},
+		{name: "doubled", backoff: time.Second, retries: 3, failures: 2, want: 4 * time.Second},
+		{name: "retries reached", backoff: time.Second, retries: 3, failures: 10, want: 8 * time.Second},
+		{name: "most retries", backoff: time.Second, retries: maxReconnectRetries, failures: 100, want: maxReconnectBackoff},
+		{name: "long backoff", backoff: 1000 * time.Hour, retries: maxReconnectRetries, failures: 100, want: maxReconnectBackoff},
+		{name: "no backoff", backoff: 0, retries: 3, failures: 5, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestExporter(t, func(cfg *Config) {
+				cfg.ReconnectBackoff, cfg.ReconnectMaxRetries = tt.backoff, tt.retries
+			})
+			e.reconnectFailures = tt.failures
+			// up to 50% jitter is added
+			if got := e.reconnectDelay(); got < tt.want || got > tt.want+tt.want/2 {
+				t.Errorf("reconnectDelay() = %v, want between %v and %v", got, tt.want, tt.want+tt.want/2)
+			}
+		})
+	}
+}
+
+// TestStreamingMaxRows checks that a streamed request that returns too many rows emits no metrics
+func TestStreamingMaxRows(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		t.Run(fmt.Sprintf("streaming=%v", streaming), func(t *testing.T) {
+			m := Metric{
+				Context:     "sessions",
+				Labels:      []string{"sid"},
+				MetricsDesc: map[string]string{"value": "Logical reads of the session."},
+				Streaming:   streaming,
+				MaxRows:     2,
+				Request:     "select sid, value from session_stats",
+			}
+			metrics, err := collectRows(t, m, []string{"SID", "VALUE"},
+				[]driver.Value{1, 10},
+				[]driver.Value{2, 20},
+				[]driver.Value{3, 30},
+			)
+			if err == nil {
+				t.Error("CollectMetric did not fail on too many rows")
+			}
+			if len(metrics) > 0 {
+				t.Errorf("CollectMetric emitted %d metrics for a request that returned too many rows", len(metrics))
+			}
+
+			metrics, err = collectRows(t, m, []string{"SID", "VALUE"},
+				[]driver.Value{1, 10},
+				[]driver.Value{2, 20},
+			)
+			if err != nil {
+				t.Fatalf("CollectMetric: %v", err)
+			}
+			assertMetrics(t, metrics, `
+# HELP oracledb_sessions_value Logical reads of the session.
+# TYPE oracledb_sessions_value gauge
+oracledb_sessions_value{sid="1"} 10
+oracledb_sessions_value{sid="2"} 20
+`)
+		})
+	}
+}
+
+// TestSlowQueryLoggedPerMetric checks that a slow metric doesn't stop the warning for another metric in its context
+func TestSlowQueryLoggedPerMetric(t *testing.T) {
+	var logs bytes.Buffer
+	e := newTestExporter(t, func(cfg *Config) { cfg.SlowQueryThreshold = time.Second })
+	e.logger = log.NewLogfmtLogger(&logs)
+	active := Metric{Context: "sessions", Request: "select count(*) as active from v$session where status = 'ACTIVE'"}
+	inactive := Metric{Context: "sessions", Request: "select count(*) as inactive from v$session where status = 'INACTIVE'"}
+
+	e.logSlowQuery(active, active.Request, 2*time.Second)
+	e.logSlowQuery(inactive, inactive.Request, 2*time.Second)
+	// logged at most once an hour per metric
+	e.logSlowQuery(active, active.Request, 2*time.Second)
+	e.logSlowQuery(inactive, inactive.Request, 2*time.Second)
+	if got := strings.Count(logs.String(), "Slow metric query"); got != 2 {
+		t.Errorf("the slow query warning was logged %d times, want 2:\n%s", got, logs.String())
+	}
+}
+
+func TestPrioritySemaphoreCancel(t *testing.T) {
+	sem := newPrioritySemaphore(1)
+	if err := sem.acquire(context.Background(), 0); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	// a metric waiting for the slot stops waiting when the scrape is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- sem.acquire(ctx, 10) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("acquire() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire kept waiting after the context was cancelled")
+	}
+
+	// the cancelled waiter was removed, so the slot is free again once released
+	sem.release()
+	if err := sem.acquire(context.Background(), 0); err != nil {
+		t.Errorf("acquire after release: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := sem.acquire(ctx, 0); err == nil {
+		t.Error("acquire got a second slot from a semaphore of size 1")
+	}
+}
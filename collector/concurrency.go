@@ -0,0 +1,126 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// concurrencyGauge counts the goroutines of a scrape in some state, e.g. waiting for a free query slot,
+// and the most there were at once during the current or last scrape. The current count is mostly 0 when
+// the exporter is scraped on request, as the metrics are only returned once the scrape has finished,
+// so the peak is what shows how close a scrape comes to its limits.
+type concurrencyGauge struct {
+	current, peak    atomic.Int64
+	gauge, peakGauge prometheus.Gauge
+}
+
+func newConcurrencyGauge(opts prometheus.GaugeOpts) *concurrencyGauge {
+	peakOpts := opts
+	peakOpts.Name += "_max"
+	peakOpts.Help = "Most at once during the last scrape: " + opts.Help
+	return &concurrencyGauge{
+		gauge:     prometheus.NewGauge(opts),
+		peakGauge: prometheus.NewGauge(peakOpts),
+	}
+}
+
+// add changes the count by delta, recording a new peak
+func (c *concurrencyGauge) add(delta int64) {
+	n := c.current.Add(delta)
+	c.gauge.Set(float64(n))
+	for {
+		peak := c.peak.Load()
+		if n <= peak {
+			return
+		}
+		if c.peak.CompareAndSwap(peak, n) {
+			c.peakGauge.Set(float64(n))
+			return
+		}
+	}
+}
+
+// resetPeak starts recording the peak of a new scrape
+func (c *concurrencyGauge) resetPeak() {
+	n := c.current.Load()
+	c.peak.Store(n)
+	c.peakGauge.Set(float64(n))
+}
+
+func (c *concurrencyGauge) collect(ch chan<- prometheus.Metric) {
+	ch <- c.gauge
+	ch <- c.peakGauge
+}
+
+// prioritySemaphore limits the number of metric queries run at once. When a slot is freed it goes to the
+// waiting query with the highest priority, and to the one that has waited longest among equal priorities,
+// so that cheap, important metrics are not starved by slow ones.
+type prioritySemaphore struct {
+	mu      sync.Mutex
+	free    int
+	waiters []semaphoreWaiter // highest priority first
+}
+
+type semaphoreWaiter struct {
+	priority int
+	ready    chan struct{}
+}
+
+func newPrioritySemaphore(size int) *prioritySemaphore {
+	return &prioritySemaphore{free: size}
+}
+
+// acquire waits for a free slot. If the context is done first, e.g. the scrape was cancelled or the exporter is
+// shutting down, it stops waiting and returns the context's error without a slot.
+func (s *prioritySemaphore) acquire(ctx context.Context, priority int) error {
+	s.mu.Lock()
+	if s.free > 0 && len(s.waiters) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	w := semaphoreWaiter{priority: priority, ready: make(chan struct{})}
+	i := sort.Search(len(s.waiters), func(i int) bool { return s.waiters[i].priority < priority })
+	s.waiters = slices.Insert(s.waiters, i, w)
+	s.mu.Unlock()
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := slices.IndexFunc(s.waiters, func(waiter semaphoreWaiter) bool { return waiter.ready == w.ready }); i >= 0 {
+		s.waiters = slices.Delete(s.waiters, i, i+1)
+	} else {
+		// the slot was handed over as the context was done, so it goes to the next waiter instead
+		s.releaseLocked()
+	}
+	return ctx.Err()
+}
+
+// release frees a slot, handing it straight to the next waiter if there is one
+func (s *prioritySemaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+func (s *prioritySemaphore) releaseLocked() {
+	if len(s.waiters) == 0 {
+		s.free++
+		return
+	}
+	w := s.waiters[0]
+	s.waiters = s.waiters[1:]
+	close(w.ready)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// containerName matches a valid container name, which is added to the ALTER SESSION statement as is
+var containerName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]*$`)
+
+// setContainer switches the session of the connection to the container, e.g. a PDB when connected to the CDB root,
+// and returns a function that switches it back to the container it was in before.
+// The connection must not go back to the pool in another container, as the queries of metrics without a container,
+// and the CON_ID probe that the dbtype gauge comes from, would then see the PDB rather than the container connected to.
+// If it cannot be switched back, it is discarded from the pool instead.
+func (e *Exporter) setContainer(ctx context.Context, conn *sql.Conn, container string) (func(), error) {
+	if !containerName.MatchString(container) {
+		return nil, fmt.Errorf("invalid container name %q", container)
+	}
+	var current string
+	if err := conn.QueryRowContext(ctx, "select sys_context('USERENV', 'CON_NAME') from dual").Scan(&current); err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "alter session set container = "+container); err != nil {
+		return nil, fmt.Errorf("unable to switch to container %s: %w", container, err)
+	}
+	return func() {
+		// the query may have timed out, so switching back has a timeout of its own
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.config.QueryTimeout)*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, "alter session set container = "+current); err != nil {
+			level.Warn(e.logger).Log("msg", "Unable to switch back to container "+current+", discarding the connection",
+				"container", container,
+				"error", err)
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}, nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// QueryRows runs the request of the metric with the given context, and returns the rows exactly as the metric
+// parser sees them: column names are lower case, and NULL columns are left out of the row.
+// It is meant for debugging metric definitions, and is not rate limited or cached.
+func (e *Exporter) QueryRows(ctx context.Context, metricContext string) ([]map[string]string, error) {
+	var metric *Metric
+	e.mu.Lock()
+	for i := range e.metricsToScrape.Metric {
+		if e.metricsToScrape.Metric[i].Context == metricContext {
+			m := e.metricsToScrape.Metric[i]
+			metric = &m
+			break
+		}
+	}
+	e.mu.Unlock()
+	if metric == nil {
+		return nil, errors.New("no metric with context " + metricContext)
+	}
+
+	rows := []map[string]string{}
+	parse := func(row map[string]string) error {
+		rows = append(rows, row)
+		return nil
+	}
+	_, err := e.queryWithFallback(ctx, e.getDB(), parse, nil, false, *metric, time.Now(), e.getQueryTimeout(*metric))
+	return rows, err
+}
+
+// LoadedMetrics returns a copy of the metrics the exporter scrapes, after the include and exclude lists are applied,
+// e.g. to list them on an endpoint. The requests are returned as they are in the metrics files, so they are not secret,
+// but values written into a request rather than bound, such as user names, would be exposed.
+// The maps of the metrics are shared with the exporter, and must not be modified.
+func (e *Exporter) LoadedMetrics() []Metric {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	metrics := make([]Metric, len(e.metricsToScrape.Metric))
+	copy(metrics, e.metricsToScrape.Metric)
+	return metrics
+}
+
+// LoadedMetrics returns a copy of the metrics scraped from the named target
+func (m *MultiExporter) LoadedMetrics(database string) ([]Metric, error) {
+	for i, name := range m.names {
+		if name == database {
+			return m.exporters[i].LoadedMetrics(), nil
+		}
+	}
+	return nil, errors.New("no target named " + database)
+}
+
+// QueryRows runs the request of the metric with the given context against the named target
+func (m *MultiExporter) QueryRows(ctx context.Context, database, metricContext string) ([]map[string]string, error) {
+	for i, name := range m.names {
+		if name == database {
+			return m.exporters[i].QueryRows(ctx, metricContext)
+		}
+	}
+	return nil, errors.New("no target named " + database)
+}
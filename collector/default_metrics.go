@@ -8,7 +8,6 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
-	"path/filepath"
 
 	"github.com/BurntSushi/toml"
 	"github.com/go-kit/log/level"
@@ -21,16 +20,45 @@ var defaultMetricsToml string
 func (e *Exporter) DefaultMetrics() Metrics {
 	var metricsToScrape Metrics
 	if e.config.DefaultMetricsFile != "" {
-		if _, err := toml.DecodeFile(filepath.Clean(e.config.DefaultMetricsFile), &metricsToScrape); err != nil {
+		if err := decodeMetricsFile(e.config.DefaultMetricsFile, &metricsToScrape); err != nil {
 			level.Error(e.logger).Log("msg", fmt.Sprintf("there was an issue while loading specified default metrics file at: "+e.config.DefaultMetricsFile+", proceeding to run with default metrics."),
 				"error", err)
 		}
-		return metricsToScrape
+		setSourceFile(metricsToScrape.Metric, e.config.DefaultMetricsFile)
+		return e.withBuiltInMetrics(metricsToScrape)
 	}
 
 	if _, err := toml.Decode(defaultMetricsToml, &metricsToScrape); err != nil {
 		level.Error(e.logger).Log(err)
 		panic(errors.New("Error while loading " + defaultMetricsToml))
 	}
-	return metricsToScrape
+	setSourceFile(metricsToScrape.Metric, "default_metrics.toml (built in)")
+	return e.withBuiltInMetrics(metricsToScrape)
+}
+
+// withBuiltInMetrics adds the built-in metrics that are enabled to the default metrics
+func (e *Exporter) withBuiltInMetrics(metrics Metrics) Metrics {
+	return e.withTopSQLMetrics(e.withASMSpaceMetrics(e.withWaitEventMetrics(metrics)))
+}
+
+// withWaitEventMetrics adds the built-in wait event metrics to the default metrics when they are enabled
+func (e *Exporter) withWaitEventMetrics(metrics Metrics) Metrics {
+	if !e.config.WaitEventMetrics {
+		return metrics
+	}
+	metric := waitEventMetric(e.config.WaitEventLimit)
+	metric.SourceFile = "wait events (built in)"
+	metrics.Metric = append(metrics.Metric, metric)
+	return metrics
+}
+
+// withTopSQLMetrics adds the built-in top SQL metrics to the default metrics when they are enabled
+func (e *Exporter) withTopSQLMetrics(metrics Metrics) Metrics {
+	if !e.config.TopSQLMetrics {
+		return metrics
+	}
+	topSQL := topSQLMetrics(e.config.TopSQLLimit)
+	setSourceFile(topSQL, "top SQL (built in)")
+	metrics.Metric = append(metrics.Metric, topSQL...)
+	return metrics
 }
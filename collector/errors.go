@@ -3,7 +3,76 @@
 
 package collector
 
-import "errors"
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/godror/godror"
+)
+
+// ErrorKind classifies the error of a metric's scrape, so that transient failures, such as timeouts and lost
+// connections, can be told apart from permanent ones, such as a missing grant or an invalid request
+type ErrorKind string
+
+const (
+	ErrorKindTimeout    ErrorKind = "timeout"
+	ErrorKindConnection ErrorKind = "connection"
+	ErrorKindPermission ErrorKind = "permission"
+	ErrorKindSyntax     ErrorKind = "syntax"
+	ErrorKindZeroResult ErrorKind = "zero_result"
+	ErrorKindMaxRows    ErrorKind = "max_rows"
+	ErrorKindOther      ErrorKind = "other"
+)
+
+// errQueryTimeout is returned when a metric's query does not finish within its query timeout
+var errQueryTimeout = errors.New("Oracle query timed out")
+
+// oraErrorKinds are the kinds of the Oracle errors that are not ErrorKindOther
+var oraErrorKinds = map[int]ErrorKind{
+	1013:  ErrorKindTimeout,    // user requested cancel of current operation, e.g. by the query timeout
+	942:   ErrorKindPermission, // table or view does not exist, usually a missing grant
+	1031:  ErrorKindPermission, // insufficient privileges
+	900:   ErrorKindSyntax,     // invalid SQL statement
+	904:   ErrorKindSyntax,     // invalid identifier
+	907:   ErrorKindSyntax,     // missing right parenthesis
+	923:   ErrorKindSyntax,     // FROM keyword not found where expected
+	933:   ErrorKindSyntax,     // SQL command not properly ended
+	936:   ErrorKindSyntax,     // missing expression
+	6550:  ErrorKindSyntax,     // PL/SQL compilation error
+	3113:  ErrorKindConnection, // end-of-file on communication channel
+	3114:  ErrorKindConnection, // not connected to ORACLE
+	3135:  ErrorKindConnection, // connection lost contact
+	12170: ErrorKindConnection, // connect timeout occurred
+	12514: ErrorKindConnection, // listener does not currently know of service
+	12541: ErrorKindConnection, // no listener
+}
+
+// errorKind returns the kind of the error of a metric's scrape
+func errorKind(err error) ErrorKind {
+	var zeroResultErr *zeroResultError
+	var maxRowsErr *maxRowsError
+	switch {
+	case errors.As(err, &zeroResultErr):
+		return ErrorKindZeroResult
+	case errors.As(err, &maxRowsErr):
+		return ErrorKindMaxRows
+	case errors.Is(err, errQueryTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindTimeout
+	case isConnectionWaitError(err), errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return ErrorKindConnection
+	}
+	if oraErr, ok := godror.AsOraErr(err); ok {
+		if kind, ok := oraErrorKinds[oraErr.Code()]; ok {
+			return kind
+		}
+	}
+	return ErrorKindOther
+}
 
 type zeroResultError struct {
 	err string
@@ -19,7 +88,62 @@ func newZeroResultError() error {
 	}
 }
 
+// maxRowsError is returned when a request returned more than the maximum number of rows
+type maxRowsError struct {
+	maxRows int
+}
+
+func (m *maxRowsError) Error() string {
+	return fmt.Sprintf("query returned more than %d rows, the metric was skipped to avoid creating too many series", m.maxRows)
+}
+
+// newMaxRowsError returns the error of a request that returned more than maxRows rows
+func newMaxRowsError(maxRows int) error {
+	return &maxRowsError{maxRows: maxRows}
+}
+
+// connectionWaitError is returned when no connection could be taken from the pool within the connection wait timeout
+type connectionWaitError struct {
+	timeout        time.Duration
+	inUse, maxOpen int
+}
+
+func (c *connectionWaitError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for a connection from the pool (%d of %d connections in use)", c.timeout, c.inUse, c.maxOpen)
+}
+
+func newConnectionWaitError(timeout time.Duration, inUse, maxOpen int) error {
+	return &connectionWaitError{timeout: timeout, inUse: inUse, maxOpen: maxOpen}
+}
+
+// isConnectionWaitError returns true if the error is because the connection pool was exhausted, rather than a query failing
+func isConnectionWaitError(err error) bool {
+	var connectionWaitErr *connectionWaitError
+	return errors.As(err, &connectionWaitErr)
+}
+
 // shouldLogScrapeError returns false if the error is a zero result error and zero result errors are ignored.
-func shouldLogScrapeError(err error, isIgnoreZeroResult bool) bool {
-	return !isIgnoreZeroResult || !errors.Is(err, newZeroResultError())
+func shouldLogScrapeError(kind ErrorKind, isIgnoreZeroResult bool) bool {
+	return !isIgnoreZeroResult || kind != ErrorKindZeroResult
+}
+
+// isTableNotFoundError returns true if the error is ORA-00942: table or view does not exist.
+// This is usually because the monitoring user has not been granted select on a view used by the metric.
+func isTableNotFoundError(err error) bool {
+	if oraErr, ok := godror.AsOraErr(err); ok {
+		return oraErr.Code() == 942
+	}
+	return strings.Contains(err.Error(), "ORA-00942")
+}
+
+// tableNotFoundHint returns the message logged when a metric fails with ORA-00942, naming the database user if it is known
+func tableNotFoundHint(user string) string {
+	if user == "" {
+		return "Error scraping metric, a table or view in its request does not exist or the database user has not been " +
+			"granted select on it. Grant select on the views used by the request to the database user, " +
+			"e.g. grant select on v_$session, or grant select_catalog_role."
+	}
+	return "Error scraping metric, a table or view in its request does not exist or the database user " +
+		user + " has not been granted select on it. Grant select on the views used by the request, " +
+		"e.g. grant select on v_$session to " + user + ", or grant select_catalog_role to " + user + "."
 }
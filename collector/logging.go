@@ -0,0 +1,77 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/godror/godror"
+)
+
+// newLogger creates a logger writing to stderr, as JSON if format is "json" and as logfmt otherwise
+func newLogger(format string) log.Logger {
+	var logger log.Logger
+	if strings.EqualFold(format, "json") {
+		logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	} else {
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	}
+	return log.With(logger, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller)
+}
+
+// logValue prepares a map or slice to be logged. JSON logs keep its structure, while logfmt,
+// which cannot encode maps and slices, gets it as a string.
+func (e *Exporter) logValue(v interface{}) interface{} {
+	if strings.EqualFold(e.config.LogFormat, "json") {
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// redacted replaces secrets in logs
+const redacted = "***"
+
+// redactSQL replaces the text matching the redact patterns in SQL that is about to be logged
+func (e *Exporter) redactSQL(sql string) string {
+	for _, re := range e.redactPatterns {
+		sql = re.ReplaceAllString(sql, redacted)
+	}
+	return sql
+}
+
+// redactBindings returns a copy of a metric's bind values with the redact patterns applied, to be logged
+func (e *Exporter) redactBindings(bindings map[string]string) map[string]string {
+	if len(e.redactPatterns) == 0 || len(bindings) == 0 {
+		return bindings
+	}
+	redactedBindings := make(map[string]string, len(bindings))
+	for name, value := range bindings {
+		redactedBindings[name] = e.redactSQL(value)
+	}
+	return redactedBindings
+}
+
+// connectionParamsLog returns the key/values to log the connection parameters with, without the password,
+// access token or private key, and with the user masked in the connect string
+func connectionParamsLog(P godror.ConnectionParams) []interface{} {
+	isSet := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return redacted
+	}
+	return []interface{}{"msg", "connection properties",
+		"username", P.Username,
+		"connectString", maskDsn(P.ConnectString),
+		"configDir", P.ConfigDir,
+		"externalAuth", P.ExternalAuth.Bool,
+		"sysdba", P.IsSysDBA,
+		"sysoper", P.IsSysOper,
+		"token", isSet(P.Token),
+		"privateKey", isSet(P.PrivateKey),
+	}
+}
@@ -4,9 +4,19 @@
 package collector
 
 import (
-	"github.com/go-kit/log/level"
+	"database/sql"
+	"errors"
+	"math"
+	"math/big"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // isScrapeMetric returns true if a metric should be scraped. Metrics may not be scraped if they have a custom scrape interval,
@@ -39,16 +49,251 @@ func (e *Exporter) getScrapeInterval(context, scrapeInterval string) (time.Durat
 	return 0, false
 }
 
+// getQueryTimeout returns the query timeout of a metric. The metric's querytimeout always takes precedence
+// over the global query.timeout, which is only used if the metric does not set a valid one.
 func (e *Exporter) getQueryTimeout(metric Metric) time.Duration {
+	queryTimeout := time.Duration(e.config.QueryTimeout) * time.Second
 	if len(metric.QueryTimeout) > 0 {
 		qt, err := time.ParseDuration(metric.QueryTimeout)
+		if err == nil && qt > 0 {
+			queryTimeout = qt
+		} else {
+			level.Warn(e.logger).Log("msg", "Invalid querytimeout, using the global query timeout instead (metric="+metric.Context+")",
+				"querytimeout", metric.QueryTimeout,
+				"fallback", queryTimeout)
+		}
+	}
+	level.Debug(e.logger).Log("msg", "Effective query timeout (metric="+metric.Context+")", "timeout", queryTimeout)
+	return queryTimeout
+}
+
+// getMaxRows returns the maximum number of rows the request of a metric may return, the metric's maxrows
+// taking precedence over the global limit. Zero means there is no limit.
+func (e *Exporter) getMaxRows(metric Metric) int {
+	if metric.MaxRows > 0 {
+		return metric.MaxRows
+	}
+	return e.config.MaxRows
+}
+
+// lastScrapeTimeToken is replaced in a request by the time the request last ran successfully, for incremental queries
+var lastScrapeTimeToken = regexp.MustCompile(`\{\{\s*\.LastScrapeTime\s*\}\}`)
+
+// incrementalRequest returns the request of a metric and its bind arguments. If the request contains {{.LastScrapeTime}},
+// e.g. "select count(*) as value from v$log_history where first_time > {{.LastScrapeTime}}", the token is replaced by the
+// :last_scrape_time bind variable, set to the time the request last ran successfully, so that only rows since then are queried.
+// Until it has run, the time is the initial window before now. A bind variable is used so that the time
+// is passed as a timestamp with its time zone, rather than relying on the session's date format.
+func (e *Exporter) incrementalRequest(m Metric, now time.Time) (string, []interface{}) {
+	args := getBindings(m)
+	if !lastScrapeTimeToken.MatchString(m.Request) {
+		return m.Request, args
+	}
+	e.cacheMu.Lock()
+	last, ok := e.lastScrapeTimes[metricKey(m)]
+	e.cacheMu.Unlock()
+	if !ok {
+		last = now.Add(-e.getInitialWindow(m))
+	}
+	return lastScrapeTimeToken.ReplaceAllString(m.Request, ":last_scrape_time"), append(args, sql.Named("last_scrape_time", last))
+}
+
+// setLastScrapeTime records when an incremental request that has run successfully started, to query from then on the next run
+func (e *Exporter) setLastScrapeTime(m Metric, started time.Time) {
+	if !lastScrapeTimeToken.MatchString(m.Request) {
+		return
+	}
+	e.cacheMu.Lock()
+	e.lastScrapeTimes[metricKey(m)] = started
+	e.cacheMu.Unlock()
+}
+
+// metricKey identifies a metric definition by its context and request, as several metrics can share a context.
+// It keys what is kept between scrapes of a metric, such as its cached results and the last scrape time of an incremental request.
+func metricKey(m Metric) string {
+	return m.Context + "\xff" + m.Request
+}
+
+// getInitialWindow returns how far back an incremental request queries the first time it runs,
+// the metric's initialwindow taking precedence over the global one
+func (e *Exporter) getInitialWindow(m Metric) time.Duration {
+	if len(m.InitialWindow) > 0 {
+		window, err := time.ParseDuration(m.InitialWindow)
+		if err == nil && window > 0 {
+			return window
+		}
+		level.Warn(e.logger).Log("msg", "Invalid initialwindow, using the global initial window instead (metric="+m.Context+")",
+			"initialwindow", m.InitialWindow)
+	}
+	return e.config.InitialWindow
+}
+
+// getBindings returns the named bind arguments of a metric's request. Environment variables
+// in the values, e.g. ${SCHEMA_NAME}, are expanded, so one definition can be used in several environments.
+func getBindings(metric Metric) []interface{} {
+	args := make([]interface{}, 0, len(metric.Bindings))
+	for name, value := range metric.Bindings {
+		args = append(args, sql.Named(name, os.ExpandEnv(value)))
+	}
+	return args
+}
+
+func isDeltaColumn(metric string, deltaColumns []string) bool {
+	for _, column := range deltaColumns {
+		if strings.EqualFold(column, metric) {
+			return true
+		}
+	}
+	return false
+}
+
+// delta returns the change in a cumulative value since the previous scrape of the same series, identified by key.
+// It returns false the first time a series is seen, and when the value went down because the counter was reset.
+func (e *Exporter) delta(key string, value float64) (float64, bool) {
+	e.deltaMu.Lock()
+	defer e.deltaMu.Unlock()
+	previous, ok := e.previousValues[key]
+	e.previousValues[key] = value
+	if !ok || value < previous {
+		return 0, false
+	}
+	return value - previous, true
+}
+
+// deltaKeyPrefix starts the keys of the series of a metric definition in previousValues and counterOffsets, followed by the column,
+// the appended field and the label values. The parts are separated by \xff, which cannot occur in UTF-8 text.
+func deltaKeyPrefix(m Metric) string {
+	return m.Context + "\xff" + m.Request + "\xff"
+}
+
+// pruneDeltas forgets the series of a metric definition that were not seen by its last scrape, e.g. of a
+// session that has ended, so that the previous values and counter offsets are not kept for every series ever seen.
+// A monotonic counter that comes back after it was forgotten starts again from its raw value.
+func (e *Exporter) pruneDeltas(prefix string, seen map[string]bool) {
+	e.deltaMu.Lock()
+	defer e.deltaMu.Unlock()
+	for key := range e.previousValues {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			delete(e.previousValues, key)
+		}
+	}
+	for key := range e.counterOffsets {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			delete(e.counterOffsets, key)
+		}
+	}
+}
+
+// counterOffset is the previous raw value of a monotonic counter, and what is added to its raw values
+// to make up for the resets seen so far
+type counterOffset struct {
+	previous float64
+	offset   float64
+}
+
+// monotonic returns a cumulative value that never goes down while the exporter runs, identified by key.
+// When the raw value goes down, e.g. because the instance restarted, the last raw value is added to the
+// offset, so the counts since the reset are added on top of those before it.
+func (e *Exporter) monotonic(key string, value float64) float64 {
+	e.deltaMu.Lock()
+	defer e.deltaMu.Unlock()
+	c, ok := e.counterOffsets[key]
+	if ok && value < c.previous {
+		level.Debug(e.logger).Log("msg", "Counter reset, adding the previous value to its offset",
+			"key", key,
+			"previous", c.previous,
+			"value", value)
+		c.offset += c.previous
+	}
+	c.previous = value
+	e.counterOffsets[key] = c
+	return value + c.offset
+}
+
+// logUnmappedValue logs a value that is missing from a metric's valuemap, only the first time it is seen
+func (e *Exporter) logUnmappedValue(context, metric, value string) {
+	if _, logged := e.unmappedValues.LoadOrStore(context+"/"+metric+"/"+value, true); !logged {
+		level.Error(e.logger).Log("msg", "Value not found in valuemap, skipping (metric="+metric+
+			",context="+context+",value=<"+value+">)")
+	}
+}
+
+// isImprecise returns true if the value is an integer too large to be represented exactly as a float64,
+// i.e. beyond 2^53, such as an SCN. The float64 is the nearest representable value, so may be off by a few units.
+func isImprecise(rawValue string, value float64) bool {
+	if math.Abs(value) <= 1<<53 {
+		return false
+	}
+	i, ok := new(big.Int).SetString(strings.TrimSpace(rawValue), 10)
+	if !ok {
+		// not an integer, e.g. a decimal or exponent, which is expected to be approximate
+		return false
+	}
+	f, _ := big.NewFloat(value).Int(nil)
+	return f.Cmp(i) != 0
+}
+
+// logMissingColumn logs a boolean column that the request doesn't return, only the first time it is seen
+func (e *Exporter) logMissingColumn(context, metric string) {
+	if _, logged := e.missingColumns.LoadOrStore(context+"/"+metric, true); !logged {
+		level.Error(e.logger).Log("msg", "Boolean field in metricsdesc is not a column of the request, skipping (metric="+metric+
+			",context="+context+")")
+	}
+}
+
+// logImpreciseValue logs that a field's value lost precision, only the first time it happens for the field
+func (e *Exporter) logImpreciseValue(context, metric, value string) {
+	if _, logged := e.impreciseValues.LoadOrStore(context+"/"+metric, true); !logged {
+		level.Warn(e.logger).Log("msg", "Value is too large to be represented exactly as a float64, the nearest value is used (metric="+metric+
+			",context="+context+",value=<"+value+">)")
+	}
+}
+
+// timestampLayouts are the layouts tried when parsing a DATE or TIMESTAMP column. The first is how
+// a time.Time is formatted by generatePrometheusMetrics, the others are for columns converted to text in the query,
+// ending with the default NLS_DATE_FORMAT (DD-MON-RR) and NLS_TIMESTAMP_FORMAT (DD-MON-RR HH.MI.SSXFF AM).
+// Month names are matched whatever their case, so 16-OCT-25 is parsed by the 02-Jan-06 layout.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"02-Jan-06 03.04.05.999999999 PM",
+	"02-Jan-06",
+	"02-Jan-2006 15:04:05",
+	"02-Jan-2006",
+}
+
+// parseTimestamp converts a DATE or TIMESTAMP column to Unix epoch seconds. The time is in the session time zone,
+// unless timezone is set, e.g. "UTC" or "Europe/London", in which case the date and time are read in that time zone.
+// If dateFormat is set, the value is parsed with that Go layout first, and then with the default layouts.
+func (e *Exporter) parseTimestamp(metric, metricHelp, value, timezone, dateFormat string) (float64, error) {
+	var t time.Time
+	var err error
+	layouts := timestampLayouts
+	if dateFormat != "" {
+		layouts = append([]string{dateFormat}, timestampLayouts...)
+	}
+	for _, layout := range layouts {
+		if t, err = time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		level.Error(e.logger).Log("msg", "Unable to convert current value to timestamp (metric="+metric+
+			",metricHelp="+metricHelp+",value=<"+value+">)")
+		return 0, err
+	}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
 		if err != nil {
-			level.Error(e.logger).Log("msg", "Unable to convert querytimeout to duration (metric="+metric.Context+")")
-			return time.Duration(e.config.QueryTimeout) * time.Second
+			level.Error(e.logger).Log("msg", "Unable to load timezone (metric="+metric+",timezone="+timezone+")", "error", err)
+			return 0, err
 		}
-		return qt
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
 	}
-	return time.Duration(e.config.QueryTimeout) * time.Second
+	return float64(t.UnixNano()) / float64(time.Second), nil
 }
 
 func (e *Exporter) parseFloat(metric, metricHelp string, row map[string]string) (float64, bool) {
@@ -64,3 +309,434 @@ func (e *Exporter) parseFloat(metric, metricHelp string, row map[string]string)
 	}
 	return valueFloat, true
 }
+
+// falseValues are the values of a boolean metric that are false, along with NULL and any number equal to 0
+var falseValues = map[string]bool{"": true, "false": true, "f": true, "no": true, "n": true, "off": true}
+
+// parseBoolean returns 1 if the value of a boolean metric is true and 0 otherwise. If trueValues is set,
+// only those values are true, regardless of case. Otherwise every value is true except the false values.
+func parseBoolean(rawValue string, trueValues []string) float64 {
+	value := strings.TrimSpace(rawValue)
+	if len(trueValues) > 0 {
+		for _, trueValue := range trueValues {
+			if strings.EqualFold(strings.TrimSpace(trueValue), value) {
+				return 1
+			}
+		}
+		return 0
+	}
+	if falseValues[strings.ToLower(value)] {
+		return 0
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil && number == 0 {
+		return 0
+	}
+	return 1
+}
+
+// nullValue returns the value to use for a metric whose column is NULL, and false if the metric should be skipped.
+// nullValue may be "zero", "nan", or "skip" to log an error and skip the metric. Otherwise the metric is skipped silently.
+func (e *Exporter) nullValue(metric, metricHelp, nullValue string) (float64, bool) {
+	switch strings.ToLower(nullValue) {
+	case "zero":
+		return 0, true
+	case "nan":
+		return math.NaN(), true
+	case "skip":
+		level.Error(e.logger).Log("msg", "Unable to convert current value to float (metric="+metric+
+			",metricHelp="+metricHelp+",value=<nil>)")
+	}
+	return 0, false
+}
+
+// parseHistogram reads the sample count and the bucket counters of a histogram metric from a row.
+// metricsBuckets maps the bucket columns to their upper limits.
+func (e *Exporter) parseHistogram(metric, metricHelp string, row map[string]string, metricsBuckets map[string]string) (uint64, map[float64]uint64, bool) {
+	count, err := strconv.ParseUint(strings.TrimSpace(row["count"]), 10, 64)
+	if err != nil {
+		level.Error(e.logger).Log("msg", "Unable to convert count value to int (metric="+metric+
+			",metricHelp="+metricHelp+",value=<"+row["count"]+">)")
+		return 0, nil, false
+	}
+	buckets := make(map[float64]uint64)
+	for field, le := range metricsBuckets {
+		lelimit, err := strconv.ParseFloat(strings.TrimSpace(le), 64)
+		if err != nil {
+			level.Error(e.logger).Log("msg", "Unable to convert bucket limit value to float (metric="+metric+
+				",metricHelp="+metricHelp+",bucketlimit=<"+le+">)")
+			continue
+		}
+		counter, err := strconv.ParseUint(strings.TrimSpace(row[field]), 10, 64)
+		if err != nil {
+			level.Error(e.logger).Log("msg", "Unable to convert ", field, " value to int (metric="+metric+
+				",metricHelp="+metricHelp+",value=<"+row[field]+">)")
+			continue
+		}
+		buckets[lelimit] = counter
+	}
+	return count, buckets, true
+}
+
+// maxRoundPlaces is the most decimal places a value can be rounded to, as a float64 has about 15 significant digits
+const maxRoundPlaces = 15
+
+// roundValue rounds a value to the given number of decimal places, and returns it as is if places is nil or negative
+func roundValue(value float64, places *int) float64 {
+	if places == nil || *places < 0 || *places > maxRoundPlaces {
+		return value
+	}
+	scale := math.Pow(10, float64(*places))
+	return math.Round(value*scale) / scale
+}
+
+// aggregates are the valid values of a metric's aggregate
+var aggregates = map[string]bool{"sum": true, "max": true, "min": true, "avg": true, "count": true}
+
+// aggregator accumulates the rows returned by the request of a metric with an aggregate, grouped by their labels
+// and field to append, and returns one row per group with the values aggregated once all rows have been added
+type aggregator struct {
+	metric Metric
+	groups map[string]*aggregateGroup
+	// the groups are returned in the order they were first seen
+	keys []string
+}
+
+// aggregateGroup is the first row of a group, and the aggregate of each value column over the rows of the group
+type aggregateGroup struct {
+	row    map[string]string
+	values map[string]*aggregateValue
+}
+
+type aggregateValue struct {
+	sum, min, max float64
+	count         int
+}
+
+func newAggregator(m Metric) *aggregator {
+	return &aggregator{metric: m, groups: map[string]*aggregateGroup{}}
+}
+
+// add adds a row to its group. NULL values, and values that are not numbers, are left out of the aggregate.
+func (a *aggregator) add(row map[string]string) error {
+	parts := make([]string, 0, len(a.metric.Labels)+1)
+	for _, label := range a.metric.Labels {
+		parts = append(parts, row[strings.ToLower(label)])
+	}
+	parts = append(parts, row[a.metric.FieldToAppend])
+	key := strings.Join(parts, "\x00")
+	group, ok := a.groups[key]
+	if !ok {
+		group = &aggregateGroup{row: row, values: map[string]*aggregateValue{}}
+		a.groups[key] = group
+		a.keys = append(a.keys, key)
+	}
+	for column := range a.metric.MetricsDesc {
+		raw, ok := row[column]
+		if !ok {
+			continue
+		}
+		value, ok := a.metric.ValueMap[column][strings.TrimSpace(raw)]
+		if !ok {
+			var err error
+			if value, err = strconv.ParseFloat(strings.TrimSpace(raw), 64); err != nil {
+				continue
+			}
+		}
+		v, ok := group.values[column]
+		if !ok {
+			group.values[column] = &aggregateValue{sum: value, min: value, max: value, count: 1}
+			continue
+		}
+		v.sum += value
+		v.min = math.Min(v.min, value)
+		v.max = math.Max(v.max, value)
+		v.count++
+	}
+	return nil
+}
+
+// rows returns a row per group, with the labels and other columns of the group's first row, and the aggregated values.
+// A value column that was NULL in every row of a group is left out, as NULL, except for a count, which is 0.
+func (a *aggregator) rows() []map[string]string {
+	rows := make([]map[string]string, 0, len(a.keys))
+	for _, key := range a.keys {
+		group := a.groups[key]
+		row := make(map[string]string, len(group.row))
+		for column, value := range group.row {
+			row[column] = value
+		}
+		for column := range a.metric.MetricsDesc {
+			v, ok := group.values[column]
+			if !ok {
+				delete(row, column)
+				if a.metric.Aggregate == "count" {
+					row[column] = "0"
+				}
+				continue
+			}
+			var value float64
+			switch a.metric.Aggregate {
+			case "sum":
+				value = v.sum
+			case "max":
+				value = v.max
+			case "min":
+				value = v.min
+			case "avg":
+				value = v.sum / float64(v.count)
+			case "count":
+				value = float64(v.count)
+			}
+			row[column] = strconv.FormatFloat(value, 'g', -1, 64)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// zeroRow returns the row emitted by a metric with emitzerorows when its request returns no rows.
+// Every field is zero, including the count and buckets of histograms and the quantiles of summaries, and the labels are empty.
+func zeroRow(m Metric) map[string]string {
+	row := map[string]string{}
+	for metric := range m.MetricsDesc {
+		row[metric] = "0"
+		switch metricTypeOf(metric, m.MetricsType) {
+		case "histogram":
+			row["count"] = "0"
+			for field := range m.MetricsBuckets[metric] {
+				row[field] = "0"
+			}
+		case "summary":
+			row["count"] = "0"
+			for field := range m.MetricsQuantiles[metric] {
+				row[field] = "0"
+			}
+		}
+	}
+	return row
+}
+
+// parseSummary reads the sample count and the quantile values of a summary metric from a row.
+// metricsQuantiles maps the quantile columns to their quantiles, e.g. p99 = "0.99".
+func (e *Exporter) parseSummary(metric, metricHelp string, row map[string]string, metricsQuantiles map[string]string) (uint64, map[float64]float64, bool) {
+	count, err := strconv.ParseUint(strings.TrimSpace(row["count"]), 10, 64)
+	if err != nil {
+		level.Error(e.logger).Log("msg", "Unable to convert count value to int (metric="+metric+
+			",metricHelp="+metricHelp+",value=<"+row["count"]+">)")
+		return 0, nil, false
+	}
+	quantiles := make(map[float64]float64)
+	for field, q := range metricsQuantiles {
+		quantile, err := strconv.ParseFloat(strings.TrimSpace(q), 64)
+		if err != nil {
+			level.Error(e.logger).Log("msg", "Unable to convert quantile value to float (metric="+metric+
+				",metricHelp="+metricHelp+",quantile=<"+q+">)")
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(row[field]), 64)
+		if err != nil {
+			level.Error(e.logger).Log("msg", "Unable to convert ", field, " value to float (metric="+metric+
+				",metricHelp="+metricHelp+",value=<"+row[field]+">)")
+			continue
+		}
+		quantiles[quantile] = value
+	}
+	return count, quantiles, true
+}
+
+// parseHelpTemplates parses the metric descriptions that contain template placeholders, e.g. {{.tablespace_name}}.
+// Descriptions that cannot be parsed are logged and used as they are.
+func (e *Exporter) parseHelpTemplates(m Metric) map[string]*template.Template {
+	templates := map[string]*template.Template{}
+	for metric, metricHelp := range m.MetricsDesc {
+		if !strings.Contains(metricHelp, "{{") {
+			continue
+		}
+		t, err := template.New(metric).Option("missingkey=zero").Parse(metricHelp)
+		if err != nil {
+			level.Error(e.logger).Log("msg", "Unable to parse metricsdesc template (metric="+metric+
+				",metricHelp="+metricHelp+")", "error", err)
+			continue
+		}
+		templates[metric] = t
+	}
+	return templates
+}
+
+// renderHelp renders the description of a metric with the column values of a row.
+// The description is returned unchanged if it is not a template, or cannot be rendered.
+func (e *Exporter) renderHelp(t *template.Template, metricHelp string, row map[string]string) string {
+	if t == nil {
+		return metricHelp
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, row); err != nil {
+		level.Error(e.logger).Log("msg", "Unable to render metricsdesc template (metricHelp="+metricHelp+")", "error", err)
+		return metricHelp
+	}
+	return b.String()
+}
+
+// bucketBoundaries returns the histogram bucket boundaries of a metric's bucketscheme
+func bucketBoundaries(m Metric) ([]float64, error) {
+	if m.BucketCount < 1 {
+		return nil, errors.New("bucketcount must be at least 1")
+	}
+	switch strings.ToLower(m.BucketScheme) {
+	case "exponential":
+		if m.BucketStart <= 0 {
+			return nil, errors.New("bucketstart must be greater than 0 for exponential buckets")
+		}
+		if m.BucketFactor <= 1 {
+			return nil, errors.New("bucketfactor must be greater than 1 for exponential buckets")
+		}
+		return prometheus.ExponentialBuckets(m.BucketStart, m.BucketFactor, m.BucketCount), nil
+	case "linear":
+		if m.BucketWidth <= 0 {
+			return nil, errors.New("bucketwidth must be greater than 0 for linear buckets")
+		}
+		return prometheus.LinearBuckets(m.BucketStart, m.BucketWidth, m.BucketCount), nil
+	default:
+		return nil, errors.New("unknown bucketscheme " + m.BucketScheme + ", must be exponential or linear")
+	}
+}
+
+// generateBuckets sets the metricsbuckets of the histogram fields of metrics with a bucketscheme.
+// The count of each bucket is read from the fields bucket_1 to bucket_<bucketcount>, in order of increasing boundary.
+func (e *Exporter) generateBuckets(metrics []Metric) {
+	for i, m := range metrics {
+		if m.BucketScheme == "" {
+			continue
+		}
+		boundaries, err := bucketBoundaries(m)
+		if err != nil {
+			level.Error(e.logger).Log("msg", "Unable to generate histogram buckets (metric="+m.Context+")", "error", err)
+			continue
+		}
+		buckets := make(map[string]string, len(boundaries))
+		for j, le := range boundaries {
+			buckets["bucket_"+strconv.Itoa(j+1)] = strconv.FormatFloat(le, 'g', -1, 64)
+		}
+		if metrics[i].MetricsBuckets == nil {
+			metrics[i].MetricsBuckets = map[string]map[string]string{}
+		}
+		for column := range m.MetricsType {
+			if metricTypeOf(column, m.MetricsType) != "histogram" {
+				continue
+			}
+			if _, ok := metrics[i].MetricsBuckets[column]; ok {
+				level.Warn(e.logger).Log("msg", "Using metricsbuckets rather than bucketscheme (metric="+m.Context+",field="+column+")")
+				continue
+			}
+			metrics[i].MetricsBuckets[column] = buckets
+		}
+	}
+}
+
+// normalizeMetrics lower cases the field names in metric definitions, as the columns of each row are keyed by
+// their lower case names. Otherwise a field written in upper case in metricsdesc would never be found in a row,
+// or its metricstype would not be found and it would silently default to a gauge.
+// Labels are not changed, as they are also the names of the labels, and are looked up in lower case instead.
+func normalizeMetrics(metrics []Metric) {
+	lowerKeys := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		lower := make(map[string]string, len(m))
+		for k, v := range m {
+			lower[strings.ToLower(k)] = v
+		}
+		return lower
+	}
+	for i := range metrics {
+		m := &metrics[i]
+		m.MetricsDesc = lowerKeys(m.MetricsDesc)
+		m.MetricsType = lowerKeys(m.MetricsType)
+		for j, column := range m.Delta {
+			m.Delta[j] = strings.ToLower(column)
+		}
+		for j, column := range m.Monotonic {
+			m.Monotonic[j] = strings.ToLower(column)
+		}
+		m.FieldToAppend = strings.ToLower(m.FieldToAppend)
+		if m.MetricsBuckets != nil {
+			buckets := make(map[string]map[string]string, len(m.MetricsBuckets))
+			for k, v := range m.MetricsBuckets {
+				buckets[strings.ToLower(k)] = lowerKeys(v)
+			}
+			m.MetricsBuckets = buckets
+		}
+		if m.MetricsQuantiles != nil {
+			quantiles := make(map[string]map[string]string, len(m.MetricsQuantiles))
+			for k, v := range m.MetricsQuantiles {
+				quantiles[strings.ToLower(k)] = lowerKeys(v)
+			}
+			m.MetricsQuantiles = quantiles
+		}
+		if m.ValueMap != nil {
+			valueMap := make(map[string]map[string]float64, len(m.ValueMap))
+			for k, v := range m.ValueMap {
+				valueMap[strings.ToLower(k)] = v
+			}
+			m.ValueMap = valueMap
+		}
+	}
+}
+
+// matchesDBVersion returns true if the database version is within the metric's mindbversion and maxdbversion.
+// Only as many components as are given are compared, so a maxdbversion of 12.2 includes 12.2.0.1.
+// Metrics are always scraped if the version is not known.
+func (e *Exporter) matchesDBVersion(m Metric) bool {
+	if e.dbVersion == "" || (m.MinDBVersion == "" && m.MaxDBVersion == "") {
+		return true
+	}
+	if m.MinDBVersion != "" {
+		if c, err := compareVersions(e.dbVersion, m.MinDBVersion); err != nil || c < 0 {
+			return false
+		}
+	}
+	if m.MaxDBVersion != "" {
+		if c, err := compareVersions(e.dbVersion, m.MaxDBVersion); err != nil || c > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compareVersions compares the leading components of a dotted version, e.g. 19.0.0.0.0, with a limit
+// such as 19 or 12.2, returning -1, 0 or 1 as the version is before, within or after the limit
+func compareVersions(version, limit string) (int, error) {
+	limits, err := parseVersion(limit)
+	if err != nil {
+		return 0, err
+	}
+	versions, err := parseVersion(version)
+	if err != nil {
+		return 0, err
+	}
+	for i, l := range limits {
+		v := 0
+		if i < len(versions) {
+			v = versions[i]
+		}
+		if v < l {
+			return -1, nil
+		}
+		if v > l {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(version string) ([]int, error) {
+	var parts []int
+	for _, p := range strings.Split(strings.TrimSpace(version), ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, errors.New("invalid version " + version)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// metricsFileExtensions are the extensions of the metrics files loaded from a custom metrics directory
+var metricsFileExtensions = []string{".toml", ".yaml", ".yml"}
+
+// isYAMLFile returns true if the metrics file is YAML rather than TOML, going by its extension
+func isYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// decodeMetricsFile loads the metric definitions in a TOML or YAML file, depending on its extension.
+// Both formats use the same schema, e.g. a YAML file has a "metric" list with "context", "metricsdesc" etc. keys.
+func decodeMetricsFile(path string, metrics *Metrics) error {
+	if !isYAMLFile(path) {
+		_, err := toml.DecodeFile(filepath.Clean(path), metrics)
+		return err
+	}
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	return decodeYAMLMetrics(b, metrics)
+}
+
+// decodeYAMLMetrics decodes YAML metric definitions. As with TOML, the field names are not case sensitive, so the
+// keys of the file and of each metric are lower cased before decoding. Other keys, e.g. the values in a valuemap,
+// are left as they are.
+func decodeYAMLMetrics(b []byte, metrics *Metrics) error {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	file := map[string]interface{}{}
+	for key, value := range raw {
+		key = strings.ToLower(key)
+		if key == "metric" {
+			list, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("metric must be a list of metric definitions")
+			}
+			for i, item := range list {
+				if m, ok := item.(map[interface{}]interface{}); ok {
+					lower := make(map[string]interface{}, len(m))
+					for k, v := range m {
+						lower[strings.ToLower(fmt.Sprint(k))] = v
+					}
+					list[i] = lower
+				}
+			}
+		}
+		file[key] = value
+	}
+	b, err := yaml.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, metrics)
+}
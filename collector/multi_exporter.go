@@ -0,0 +1,220 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Target is the connection configuration of a single database monitored by a MultiExporter.
+// Empty fields other than Name and ConnectString are taken from the base Config.
+type Target struct {
+	Name           string
+	User           string
+	ProxyUser      string
+	Password       string
+	ConnectString  string
+	DbRole         string
+	ConfigDir      string
+	WalletLocation string
+}
+
+// Targets is a container structure for the databases monitored by a MultiExporter
+type Targets struct {
+	Target []Target
+}
+
+// MultiExporter collects metrics from several Oracle databases, one Exporter per database.
+// Every metric is labeled with the name of the database it was collected from.
+type MultiExporter struct {
+	names       []string
+	exporters   []*Exporter
+	maxParallel int
+	logger      log.Logger
+	intervalCh  chan time.Duration
+}
+
+// LoadTargets reads the list of databases to monitor from a TOML file
+func LoadTargets(file string) ([]Target, error) {
+	var targets Targets
+	if _, err := toml.DecodeFile(filepath.Clean(file), &targets); err != nil {
+		return nil, err
+	}
+	if len(targets.Target) == 0 {
+		return nil, errors.New("no targets defined in " + file)
+	}
+	for _, t := range targets.Target {
+		if t.ConnectString == "" {
+			return nil, errors.New("target " + t.Name + " in " + file + " has no connectstring")
+		}
+	}
+	return targets.Target, nil
+}
+
+// NewMultiExporter creates an Exporter for each target. A target that cannot be connected to is
+// still monitored, and will report itself as down until the database is reachable.
+// maxParallel bounds the number of targets scraped at the same time by RunScheduledScrapes.
+func NewMultiExporter(logger log.Logger, cfg *Config, targets []Target, maxParallel int) (*MultiExporter, error) {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+	m := &MultiExporter{
+		maxParallel: maxParallel,
+		logger:      logger,
+		intervalCh:  make(chan time.Duration, 1),
+	}
+	for _, t := range targets {
+		name := t.Name
+		if name == "" {
+			name = maskDsn(t.ConnectString)
+		}
+		tcfg := *cfg
+		tcfg.ConnectString = t.ConnectString
+		if t.User != "" {
+			tcfg.User = t.User
+		}
+		if t.ProxyUser != "" {
+			tcfg.ProxyUser = t.ProxyUser
+		}
+		if t.Password != "" {
+			tcfg.Password = t.Password
+			tcfg.PasswordFile = ""
+			tcfg.SecretProvider = nil
+		}
+		if t.DbRole != "" {
+			tcfg.DbRole = t.DbRole
+		}
+		if t.ConfigDir != "" {
+			tcfg.ConfigDir = t.ConfigDir
+		}
+		if t.WalletLocation != "" {
+			tcfg.WalletLocation = t.WalletLocation
+		}
+		e, err := NewExporter(log.With(logger, "database", name), &tcfg)
+		if e == nil {
+			return nil, err
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "unable to connect to DB", "database", name, "error", err)
+		}
+		e.target = name
+		m.names = append(m.names, name)
+		m.exporters = append(m.exporters, e)
+	}
+	return m, nil
+}
+
+// Register registers the Exporter of every target, adding a database label to all of its metrics
+func (m *MultiExporter) Register(reg prometheus.Registerer) error {
+	for i, e := range m.exporters {
+		wrapped := prometheus.WrapRegistererWith(prometheus.Labels{"database": m.names[i]}, reg)
+		if err := wrapped.Register(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReloadMetrics reloads the default and custom metrics definitions of every target, and returns the errors of all of them
+func (m *MultiExporter) ReloadMetrics() error {
+	var errs []error
+	for i, e := range m.exporters {
+		if err := e.ReloadMetrics(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// UpdateConnectString switches the named target to another connect string
+func (m *MultiExporter) UpdateConnectString(database, connectString string) error {
+	for i, name := range m.names {
+		if name == database {
+			return m.exporters[i].UpdateConnectString(connectString)
+		}
+	}
+	return errors.New("no target named " + database)
+}
+
+// Ready returns an error naming every target whose database cannot be reached
+func (m *MultiExporter) Ready(ctx context.Context) error {
+	var errs []error
+	for i, e := range m.exporters {
+		if err := e.Ready(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunScheduledScrapes scrapes all targets on a timer, at most maxParallel targets at a time
+func (m *MultiExporter) RunScheduledScrapes(ctx context.Context, si time.Duration) {
+	for _, e := range m.exporters {
+		e.scrapeInterval.Store(&si)
+	}
+
+	m.doScrape(ctx, time.Now())
+
+	ticker := time.NewTicker(si)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case tick := <-ticker.C:
+			// scraped in the background, so that one hung target doesn't hold up the ticker for the others
+			go m.doScrape(ctx, tick)
+		case si := <-m.intervalCh:
+			ticker.Reset(si)
+			level.Info(m.logger).Log("msg", "Scrape interval changed", "interval", si)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SetScrapeInterval changes the interval of the scheduled scrapes of all targets while RunScheduledScrapes is running.
+// It waits for the scrape in progress of each target to finish, and the next scrape is then one new interval later.
+func (m *MultiExporter) SetScrapeInterval(si time.Duration) error {
+	if si <= 0 {
+		return errors.New("the scrape interval must be more than 0")
+	}
+	// every target is checked before any is changed, so that an error leaves all of them on the old interval
+	for _, e := range m.exporters {
+		if !e.scheduled() {
+			return errors.New("scheduled scrapes are not running")
+		}
+	}
+	for _, e := range m.exporters {
+		e.mu.Lock()
+		e.scrapeInterval.Store(&si)
+		e.mu.Unlock()
+	}
+	sendInterval(m.intervalCh, si)
+	return nil
+}
+
+func (m *MultiExporter) doScrape(ctx context.Context, tick time.Time) {
+	sem := make(chan struct{}, m.maxParallel)
+	wg := sync.WaitGroup{}
+	for _, e := range m.exporters {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(e *Exporter) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			e.doScrape(ctx, tick)
+		}(e)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// slowQueryLogInterval is how often a slow query of the same metric is logged at most
+const slowQueryLogInterval = time.Hour
+
+// logSlowQuery logs a warning if a metric's query took longer than the slow query threshold, at most once an hour
+// per metric, with the execution plan of the query if plan capture is enabled.
+// The plan is fetched in the background, so that it doesn't hold up a scrape that is already slow.
+func (e *Exporter) logSlowQuery(m Metric, query string, elapsed time.Duration) {
+	if e.config.SlowQueryThreshold <= 0 || elapsed < e.config.SlowQueryThreshold {
+		return
+	}
+	e.cacheMu.Lock()
+	last, ok := e.slowQueryLogged[metricKey(m)]
+	if ok && time.Since(last) < slowQueryLogInterval {
+		e.cacheMu.Unlock()
+		return
+	}
+	e.slowQueryLogged[metricKey(m)] = time.Now()
+	e.cacheMu.Unlock()
+
+	// a PL/SQL block has no plan of its own, only the queries it runs do
+	if !e.config.CapturePlans || m.PLSQL {
+		level.Warn(e.logger).Log("msg", "Slow metric query",
+			"Context", m.Context,
+			"elapsed", elapsed,
+			"threshold", e.config.SlowQueryThreshold)
+		return
+	}
+	go func() {
+		plan, err := e.queryPlan(query)
+		if err != nil {
+			level.Warn(e.logger).Log("msg", "Slow metric query, unable to get its execution plan",
+				"Context", m.Context,
+				"elapsed", elapsed,
+				"threshold", e.config.SlowQueryThreshold,
+				"error", err)
+			return
+		}
+		level.Warn(e.logger).Log("msg", "Slow metric query, logging its execution plan",
+			"Context", m.Context,
+			"elapsed", elapsed,
+			"threshold", e.config.SlowQueryThreshold,
+			"plan", e.redactSQL(plan))
+	}()
+}
+
+// queryPlan returns the execution plan of the most recently run cursor of the query, formatted by DBMS_XPLAN.
+// The cursor is found in v$sql by the first 1000 characters of the query, which is all that sql_text holds.
+func (e *Exporter) queryPlan(query string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.config.QueryTimeout)*time.Second)
+	defer cancel()
+	// run in the background, without holding mu
+	db := e.getDB()
+	var sqlID string
+	var childNumber int
+	err := db.QueryRowContext(ctx, `select sql_id, child_number from (
+  select sql_id, child_number from v$sql where sql_text = substr(:1, 1, 1000) order by last_active_time desc
+) where rownum = 1`, query).Scan(&sqlID, &childNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errors.New("the query was not found in v$sql")
+	}
+	if err != nil {
+		return "", err
+	}
+	rows, err := db.QueryContext(ctx, "select plan_table_output from table(dbms_xplan.display_cursor(:1, :2, 'TYPICAL'))", sqlID, childNumber)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var line sql.NullString
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line.String)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
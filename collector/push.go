@@ -0,0 +1,46 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushJob is the default job name the metrics are pushed to the Pushgateway under
+const pushJob = "oracledb_exporter"
+
+// push sends the results of the last scheduled scrape to the Pushgateway.
+// The metrics are grouped by database, i.e. the target name or else the service name, and by database instance,
+// so that exporters pushing to the same Pushgateway don't overwrite each other.
+// A failed push is logged and counted, and is retried with fresh results on the next interval.
+func (e *Exporter) push() {
+	job := e.config.PushgatewayJob
+	if job == "" {
+		job = pushJob
+	}
+	database := e.target
+	if database == "" {
+		database = e.serviceName
+	}
+	if database == "" {
+		database = maskDsn(e.connectString)
+	}
+	instance := e.instanceName
+	if instance == "" {
+		instance = maskDsn(e.connectString)
+	}
+	if err := push.New(e.config.PushgatewayURL, job).
+		Collector(e).
+		Grouping("database", database).
+		Grouping("instance", instance).
+		Push(); err != nil {
+		e.pushErrors.Inc()
+		level.Error(e.logger).Log("msg", "Error pushing metrics to Pushgateway",
+			"url", e.config.PushgatewayURL,
+			"error", err)
+		return
+	}
+	level.Debug(e.logger).Log("msg", "Pushed metrics to Pushgateway", "url", e.config.PushgatewayURL, "database", database, "instance", instance)
+}
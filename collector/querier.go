@@ -0,0 +1,60 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Querier runs the requests of metrics. It is implemented by *sql.DB, including the *sql.DB of a fake database
+// driver such as go-sqlmock, which is how the metrics are tested without an Oracle database.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	// Conn is used for PL/SQL requests and metrics with a container, which need a session of their own
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// CollectMetric runs the request of a metric against db and returns the metrics it emits, as they would be
+// scraped with the default configuration. It lets the authors of custom metrics test a metric definition with
+// the rows its request is expected to return, e.g. in a table-driven test with go-sqlmock:
+//
+//	db, mock, _ := sqlmock.New()
+//	mock.ExpectQuery("SELECT status, type, COUNT").
+//		WillReturnRows(sqlmock.NewRows([]string{"STATUS", "TYPE", "VALUE"}).AddRow("ACTIVE", "USER", 3))
+//	metrics, err := collector.CollectMetric(ctx, db, metric)
+//
+// The metric is validated first, and an error listing its problems is returned if it is not valid.
+// Features that depend on earlier scrapes, such as delta and {{.LastScrapeTime}}, behave as on the first scrape.
+func CollectMetric(ctx context.Context, db Querier, m Metric) ([]prometheus.Metric, error) {
+	metrics := []Metric{m}
+	normalizeMetrics(metrics)
+	if errs := validateMetric(metrics[0]); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	e, err := newExporter(log.NewNopLogger(), CreateDefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	e.generateBuckets(metrics)
+	m = metrics[0]
+
+	var results []prometheus.Metric
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range ch {
+			results = append(results, metric)
+		}
+	}()
+	err = e.scrapeGenericValues(ctx, db, ch, m, e.getQueryTimeout(m))
+	close(ch)
+	<-done
+	return results, err
+}
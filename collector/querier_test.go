@@ -0,0 +1,136 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/oracle/oracle-db-appdev-monitoring/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// metrics is a collector of the metrics returned by CollectMetric, to compare them with testutil
+type metrics []prometheus.Metric
+
+func (ms metrics) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(ms, ch)
+}
+
+func (ms metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range ms {
+		ch <- m
+	}
+}
+
+// TestCollectMetric tests metric definitions the way the authors of custom metrics would, with go-sqlmock
+func TestCollectMetric(t *testing.T) {
+	sessions := collector.Metric{
+		Context:     "sessions",
+		Labels:      []string{"status", "type"},
+		MetricsDesc: map[string]string{"value": "Gauge metric with count of sessions by status and type."},
+		Request:     "SELECT status, type, COUNT(*) as value FROM v$session GROUP BY status, type",
+	}
+	queryErr := errors.New("ORA-00942: table or view does not exist")
+	tests := []struct {
+		name    string
+		metric  collector.Metric
+		columns []string
+		rows    [][]driver.Value
+		err     error
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "gauge with labels",
+			metric:  sessions,
+			columns: []string{"STATUS", "TYPE", "VALUE"},
+			rows:    [][]driver.Value{{"ACTIVE", "USER", 3}, {"INACTIVE", "BACKGROUND", 1}},
+			want: `
+# HELP oracledb_sessions_value Gauge metric with count of sessions by status and type.
+# TYPE oracledb_sessions_value gauge
+oracledb_sessions_value{status="ACTIVE",type="USER"} 3
+oracledb_sessions_value{status="INACTIVE",type="BACKGROUND"} 1
+`,
+		},
+		{
+			name: "counter",
+			metric: collector.Metric{
+				Context:     "activity",
+				MetricsDesc: map[string]string{"execute_count": "Generic counter metric from v$sysstat view in Oracle."},
+				MetricsType: map[string]string{"execute_count": "counter"},
+				Request:     "SELECT value as execute_count FROM v$sysstat WHERE name = 'execute count'",
+			},
+			columns: []string{"EXECUTE_COUNT"},
+			rows:    [][]driver.Value{{1234}},
+			want: `
+# HELP oracledb_activity_execute_count Generic counter metric from v$sysstat view in Oracle.
+# TYPE oracledb_activity_execute_count counter
+oracledb_activity_execute_count 1234
+`,
+		},
+		{
+			name:    "no rows",
+			metric:  sessions,
+			columns: []string{"STATUS", "TYPE", "VALUE"},
+			wantErr: "query returned no rows",
+		},
+		{
+			name:    "query error",
+			metric:  sessions,
+			err:     queryErr,
+			wantErr: queryErr.Error(),
+		},
+		{
+			name: "invalid metric",
+			metric: collector.Metric{
+				Context:     "sessions",
+				MetricsDesc: map[string]string{"value": "Sessions."},
+				MetricsType: map[string]string{"value": "gauges"},
+				Request:     "SELECT COUNT(*) as value FROM v$session",
+			},
+			wantErr: "gauges",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer db.Close()
+			if tt.err != nil {
+				mock.ExpectQuery(tt.metric.Request).WillReturnError(tt.err)
+			} else if tt.columns != nil {
+				rows := sqlmock.NewRows(tt.columns)
+				for _, row := range tt.rows {
+					rows.AddRow(row...)
+				}
+				mock.ExpectQuery(tt.metric.Request).WillReturnRows(rows)
+			}
+
+			got, err := collector.CollectMetric(context.Background(), db, tt.metric)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("CollectMetric error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CollectMetric: %v", err)
+			}
+			if err := testutil.CollectAndCompare(metrics(got), strings.NewReader(tt.want)); err != nil {
+				t.Error(err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
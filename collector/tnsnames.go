@@ -0,0 +1,129 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log/level"
+)
+
+// isTNSAlias returns true if the connect string is a net service name, rather than an
+// easy connect string or a full connect descriptor
+func isTNSAlias(connectString string) bool {
+	return connectString != "" && !strings.ContainsAny(connectString, "/:()@= ")
+}
+
+// checkTNSAlias logs an error listing the aliases in tnsnames.ora if the connect string is an alias
+// that is not in the tnsnames.ora file in configDir. A mistyped alias otherwise only shows up as a
+// connection failure when the database is first used.
+func (e *Exporter) checkTNSAlias(configDir string) {
+	if configDir == "" || !isTNSAlias(e.connectString) {
+		return
+	}
+	path := filepath.Join(configDir, "tnsnames.ora")
+	aliases, err := tnsAliases(path)
+	if errors.Is(err, os.ErrNotExist) {
+		level.Debug(e.logger).Log("msg", "No tnsnames.ora in "+configDir+", not checking the connect string alias")
+		return
+	}
+	if err != nil {
+		level.Warn(e.logger).Log("msg", "Unable to read tnsnames.ora to check the connect string alias", "file", path, "error", err)
+		return
+	}
+	alias := strings.ToLower(e.connectString)
+	for _, a := range aliases {
+		// an alias without a domain matches an entry with one, e.g. mydb matches mydb.world
+		if a == alias || strings.HasPrefix(a, alias+".") {
+			level.Debug(e.logger).Log("msg", "Found connect string alias "+e.connectString+" in "+path)
+			return
+		}
+	}
+	level.Error(e.logger).Log("msg", "The connect string alias "+e.connectString+" is not defined in "+path,
+		"available", strings.Join(aliases, ","))
+}
+
+// tnsAliases returns the net service names defined in a tnsnames.ora file, in lower case, following IFILE includes
+func tnsAliases(path string) ([]string, error) {
+	seen := map[string]bool{}
+	aliases := []string{}
+	if err := readTNSAliases(path, seen, &aliases); err != nil {
+		return nil, err
+	}
+	sort.Strings(aliases)
+	return aliases, nil
+}
+
+func readTNSAliases(path string, seen map[string]bool, aliases *[]string) error {
+	if seen[path] {
+		return nil
+	}
+	seen[path] = true
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// entries are "alias[, alias...] = (DESCRIPTION = ...)", the names being the text at parenthesis depth zero
+	depth := 0
+	var name strings.Builder
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		for _, c := range line {
+			switch {
+			case c == '(':
+				depth++
+			case c == ')':
+				depth--
+			case depth == 0 && c == '=':
+				names := strings.TrimSpace(name.String())
+				name.Reset()
+				if strings.EqualFold(names, "IFILE") {
+					// the included file name follows on the same line
+					continue
+				}
+				for _, n := range strings.Split(names, ",") {
+					if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+						*aliases = append(*aliases, n)
+					}
+				}
+			case depth == 0:
+				name.WriteRune(c)
+			}
+		}
+		if depth == 0 {
+			if ifile, ok := includedFile(line); ok {
+				name.Reset()
+				if !filepath.IsAbs(ifile) {
+					ifile = filepath.Join(filepath.Dir(path), ifile)
+				}
+				if err := readTNSAliases(ifile, seen, aliases); err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// includedFile returns the file name if the line is an "IFILE = file" include
+func includedFile(line string) (string, bool) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "IFILE") {
+		return "", false
+	}
+	return strings.Trim(strings.TrimSpace(value), `"'`), true
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import "fmt"
+
+// topSQLContext and topSQLInfoContext are the contexts of the built-in top SQL metrics, which can be used in the
+// collector include and exclude lists. They differ from the top_sql context of the default metrics, which are
+// labeled with the sql_id, so that those can be excluded while keeping these.
+const (
+	topSQLContext     = "top_sql_rank"
+	topSQLInfoContext = "top_sql_rank_info"
+)
+
+// topSQLRequest ranks the limit statements in v$sqlstats with the most elapsed time
+const topSQLRequest = `select rank, sql_id, elapsed_seconds, cpu_seconds, executions from (
+  select rownum rank, sql_id, elapsed_seconds, cpu_seconds, executions from (
+    select sql_id, elapsed_time/1000000 elapsed_seconds, cpu_time/1000000 cpu_seconds, executions
+    from v$sqlstats
+    order by elapsed_time desc
+  )
+  where rownum <= %d
+)`
+
+// topSQLMetrics returns the built-in metrics with the limit statements with the most elapsed time. The values
+// are labeled with the rank only, so that there are never more than limit series however often the statements
+// change, and the sql_id at each rank is in a separate info metric, to be joined on rank.
+func topSQLMetrics(limit int) []Metric {
+	request := fmt.Sprintf(topSQLRequest, limit)
+	return []Metric{
+		{
+			Context: topSQLContext,
+			Labels:  []string{"rank"},
+			MetricsDesc: map[string]string{
+				"elapsed_seconds": "Elapsed time of the statement at this rank by elapsed time, in seconds, from the v$sqlstats view in Oracle.",
+				"cpu_seconds":     "CPU time of the statement at this rank by elapsed time, in seconds, from the v$sqlstats view in Oracle.",
+				"executions":      "Number of executions of the statement at this rank by elapsed time, from the v$sqlstats view in Oracle.",
+			},
+			Request:          request,
+			IgnoreZeroResult: true,
+		},
+		{
+			Context: topSQLInfoContext,
+			Labels:  []string{"rank", "sql_id"},
+			MetricsDesc: map[string]string{
+				"info": "The sql_id of the statement at this rank by elapsed time, always 1, to be joined with the top_sql_rank metrics on rank.",
+			},
+			MetricsType:      map[string]string{"info": "info"},
+			Request:          fmt.Sprintf("select rank, sql_id from (%s)", request),
+			IgnoreZeroResult: true,
+		},
+	}
+}
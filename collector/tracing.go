@@ -0,0 +1,55 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import "context"
+
+// Tracer starts a span around each metric query, when set in the Config. It has the same shape as the
+// OpenTelemetry tracing API, so that an OpenTelemetry tracer can be used with a small adapter, e.g.
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string) (context.Context, collector.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) SetAttribute(key string, value interface{}) {
+//		s.Span.SetAttributes(attribute.String(key, fmt.Sprint(value)))
+//	}
+//
+//	func (s otelSpan) RecordError(err error) {
+//		s.Span.RecordError(err)
+//		s.Span.SetStatus(codes.Error, err.Error())
+//	}
+//
+//	func (s otelSpan) End() { s.Span.End() }
+//
+//	cfg.Tracer = otelTracer{otel.Tracer("oracledb_exporter")}
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// startSpan starts a span if a tracer is configured, otherwise it returns a span that does nothing
+func (e *Exporter) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if e.config.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return e.config.Tracer.Start(ctx, name)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
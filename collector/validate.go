@@ -0,0 +1,194 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ValidateMetricsFile loads a metrics definition file and checks every metric in it, without connecting to a database.
+// It returns the metrics that were loaded, and an error listing every problem found in each of them.
+func ValidateMetricsFile(path string) ([]Metric, error) {
+	var metrics Metrics
+	if err := decodeMetricsFile(path, &metrics); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	normalizeMetrics(metrics.Metric)
+	var errs []error
+	for i, metric := range metrics.Metric {
+		for _, err := range validateMetric(metric) {
+			errs = append(errs, fmt.Errorf("%s: metric %d (context=%s): %w", path, i+1, metric.Context, err))
+		}
+	}
+	return metrics.Metric, errors.Join(errs...)
+}
+
+// validateMetric returns the problems with a metric definition
+func validateMetric(metric Metric) []error {
+	var errs []error
+	if len(metric.Context) == 0 {
+		errs = append(errs, errors.New("context is required"))
+	}
+	if len(metric.Request) == 0 {
+		errs = append(errs, errors.New("request is required"))
+	}
+	for i, request := range metric.RequestFallback {
+		if len(strings.TrimSpace(request)) == 0 {
+			errs = append(errs, fmt.Errorf("requestfallback %d is empty", i+1))
+		}
+	}
+	if len(metric.MetricsDesc) == 0 {
+		errs = append(errs, errors.New("metricsdesc is required"))
+	}
+	for column, help := range metric.MetricsDesc {
+		if strings.Contains(help, "{{") {
+			// without fieldtoappend every row shares one metric name, which must have a single HELP
+			if metric.FieldToAppend == "" {
+				errs = append(errs, fmt.Errorf("metricsdesc of %s can only contain a template with fieldtoappend", column))
+			} else if _, err := template.New(column).Parse(help); err != nil {
+				errs = append(errs, fmt.Errorf("metricsdesc of %s: %w", column, err))
+			}
+		}
+	}
+	for column := range metric.MetricsType {
+		if _, ok := metric.MetricsDesc[column]; !ok {
+			errs = append(errs, fmt.Errorf("metricstype of %s has no matching metricsdesc", column))
+		}
+	}
+	for column := range metric.MetricsType {
+		if _, err := getMetricType(column, metric.MetricsType); err != nil {
+			errs = append(errs, fmt.Errorf("metricstype of %s: %w", column, err))
+			continue
+		}
+		switch metricTypeOf(column, metric.MetricsType) {
+		case "histogram":
+			_, ok := metric.MetricsBuckets[column]
+			if ok && metric.BucketScheme != "" {
+				errs = append(errs, fmt.Errorf("metricsbuckets and bucketscheme cannot both be defined for histogram %s", column))
+			} else if !ok && metric.BucketScheme == "" {
+				errs = append(errs, fmt.Errorf("metricsbuckets or bucketscheme is required for histogram %s", column))
+			}
+		case "summary":
+			if _, ok := metric.MetricsQuantiles[column]; !ok {
+				errs = append(errs, fmt.Errorf("metricsquantiles is required for summary %s", column))
+			}
+		}
+	}
+	if metric.BucketScheme != "" {
+		if _, err := bucketBoundaries(metric); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for name, version := range map[string]string{"mindbversion": metric.MinDBVersion, "maxdbversion": metric.MaxDBVersion} {
+		if version != "" {
+			if _, err := parseVersion(version); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	if len(metric.QueryTimeout) > 0 {
+		if _, err := time.ParseDuration(metric.QueryTimeout); err != nil {
+			errs = append(errs, fmt.Errorf("querytimeout: %w", err))
+		}
+	}
+	if len(metric.ScrapeInterval) > 0 {
+		if _, err := time.ParseDuration(metric.ScrapeInterval); err != nil {
+			errs = append(errs, fmt.Errorf("scrapeinterval: %w", err))
+		}
+	}
+	for _, column := range metric.Monotonic {
+		if metricTypeOf(column, metric.MetricsType) != "counter" {
+			errs = append(errs, fmt.Errorf("monotonic column %s must have the counter metricstype", column))
+		}
+		if isDeltaColumn(column, metric.Delta) {
+			errs = append(errs, fmt.Errorf("column %s cannot be both delta and monotonic", column))
+		}
+	}
+	if metric.Round != nil && *metric.Round > maxRoundPlaces {
+		errs = append(errs, fmt.Errorf("round cannot be more than %d decimal places", maxRoundPlaces))
+	}
+	if metric.Aggregate != "" {
+		if !aggregates[metric.Aggregate] {
+			errs = append(errs, fmt.Errorf("aggregate %s is not one of sum, max, min, avg or count", metric.Aggregate))
+		}
+		for column := range metric.MetricsDesc {
+			switch metricTypeOf(column, metric.MetricsType) {
+			case "histogram", "summary", "timestamp", "boolean":
+				errs = append(errs, fmt.Errorf("aggregate cannot be used with the %s metric %s", metricTypeOf(column, metric.MetricsType), column))
+			}
+		}
+	}
+	if len(metric.TrueValues) > 0 && !hasMetricType(metric, "boolean") {
+		errs = append(errs, errors.New("truevalues is only used by fields with the boolean metricstype"))
+	}
+	if metric.Streaming && metric.Aggregate != "" {
+		errs = append(errs, errors.New("streaming cannot be used with aggregate, which keeps every row until all have been read"))
+	}
+	if metric.SampleEvery < 0 {
+		errs = append(errs, errors.New("sampleevery cannot be negative"))
+	}
+	if metric.SampleEvery > 1 && (len(metric.CacheTTL) > 0 || len(metric.ScrapeInterval) > 0) {
+		errs = append(errs, errors.New("sampleevery cannot be used with cachettl or scrapeinterval"))
+	}
+	if metric.EmitZeroRows && metric.FieldToAppend != "" {
+		errs = append(errs, errors.New("emitzerorows cannot be used with fieldtoappend, as the metric names come from the rows"))
+	}
+	if len(metric.InitialWindow) > 0 {
+		if _, err := time.ParseDuration(metric.InitialWindow); err != nil {
+			errs = append(errs, fmt.Errorf("initialwindow: %w", err))
+		}
+	}
+	if metric.DateFormat != "" {
+		// a layout without any date or time elements is returned as is when formatting
+		reference := time.Date(2025, time.October, 16, 13, 14, 15, 0, time.UTC)
+		if _, err := time.Parse(metric.DateFormat, reference.Format(metric.DateFormat)); err != nil || reference.Format(metric.DateFormat) == metric.DateFormat {
+			errs = append(errs, fmt.Errorf("dateformat %s is not a valid Go time layout, e.g. 02-Jan-06 15:04:05", metric.DateFormat))
+		}
+	}
+	if metric.Container != "" {
+		if !containerName.MatchString(metric.Container) {
+			errs = append(errs, fmt.Errorf("container %s is not a valid container name", metric.Container))
+		}
+		for _, label := range metric.Labels {
+			if strings.EqualFold(label, "container") {
+				errs = append(errs, errors.New("the container label is added when container is set, and cannot be in labels"))
+			}
+		}
+	}
+	switch strings.ToUpper(strings.TrimSpace(metric.DatabaseRole)) {
+	case "", "PRIMARY", "PHYSICAL STANDBY", "LOGICAL STANDBY", "SNAPSHOT STANDBY", "FAR SYNC":
+	default:
+		errs = append(errs, fmt.Errorf("databaserole %s is not a valid database role", metric.DatabaseRole))
+	}
+	return errs
+}
+
+// hasMetricType returns true if a field of the metric has the metric type
+func hasMetricType(metric Metric, metricType string) bool {
+	for column := range metric.MetricsDesc {
+		if metricTypeOf(column, metric.MetricsType) == metricType {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConstLabels returns an error if a metric has a label with the same name as one of the constant labels
+func checkConstLabels(metrics []Metric, constLabels map[string]string) error {
+	for _, metric := range metrics {
+		for _, label := range metric.Labels {
+			if _, ok := constLabels[label]; ok {
+				return fmt.Errorf("label %s of metric %s is also a constant label", label, metric.Context)
+			}
+		}
+		if _, ok := constLabels["container"]; ok && metric.Container != "" {
+			return fmt.Errorf("label container of metric %s is also a constant label", metric.Context)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import "fmt"
+
+// waitEventContext is the context of the built-in wait event metrics, which can be used in the collector include and exclude lists
+const waitEventContext = "wait_event"
+
+// waitEventMetric returns the built-in metric with the limit non-idle wait events with the most time waited since instance startup
+func waitEventMetric(limit int) Metric {
+	return Metric{
+		Context: waitEventContext,
+		Labels:  []string{"wait_class", "event"},
+		MetricsDesc: map[string]string{
+			"total_waits":               "Total number of waits for the event, from the v$system_event view in Oracle.",
+			"time_waited_seconds_total": "Total amount of time waited for the event in seconds, from the v$system_event view in Oracle.",
+		},
+		MetricsType: map[string]string{
+			"total_waits":               "counter",
+			"time_waited_seconds_total": "counter",
+		},
+		Request: fmt.Sprintf(`select wait_class, event, total_waits, time_waited_seconds_total from (
+  select wait_class, event, sum(total_waits) total_waits, sum(time_waited_micro)/1000000 time_waited_seconds_total
+  from v$system_event
+  where wait_class <> 'Idle'
+  group by wait_class, event
+  order by time_waited_seconds_total desc
+)
+where rownum <= %d`, limit),
+		IgnoreZeroResult: true,
+	}
+}
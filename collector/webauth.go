@@ -0,0 +1,67 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package collector
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// WithAuth wraps an HTTP handler, e.g. the Prometheus metrics handler, so that requests must authenticate with
+// basic authentication as cfg.WebAuthUser with the password in cfg.WebAuthPasswordFile, or with the bearer token
+// in cfg.WebBearerTokenFile. If both are configured, either is accepted. If neither is, the handler is returned as is.
+//
+// The files are read on every request, so that the credentials can be rotated, e.g. by updating a Kubernetes secret,
+// without restarting the exporter. Trailing newlines in the files are ignored.
+func WithAuth(cfg *Config, logger log.Logger, handler http.Handler) http.Handler {
+	basicAuth := cfg.WebAuthUser != "" && cfg.WebAuthPasswordFile != ""
+	bearerAuth := cfg.WebBearerTokenFile != ""
+	if !basicAuth && !bearerAuth {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if basicAuth {
+			if user, password, ok := r.BasicAuth(); ok {
+				if authenticated(logger, cfg.WebAuthPasswordFile, password) && equal(user, cfg.WebAuthUser) {
+					handler.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		if bearerAuth {
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				if authenticated(logger, cfg.WebBearerTokenFile, token) {
+					handler.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		if basicAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oracledb_exporter"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// authenticated returns true if the secret matches the contents of the file
+func authenticated(logger log.Logger, file, secret string) bool {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		// the request is refused rather than let through if the file cannot be read
+		level.Error(logger).Log("msg", "Unable to read web authentication file", "file", file, "error", err)
+		return false
+	}
+	expected := strings.TrimRight(string(b), "\r\n")
+	return expected != "" && equal(secret, expected)
+}
+
+// equal compares the strings in constant time, so that the comparison doesn't reveal how much of a secret is right
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
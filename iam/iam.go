@@ -0,0 +1,88 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package iam
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/common/auth"
+	"github.com/oracle/oci-go-sdk/v65/identitydataplane"
+)
+
+// dbTokenScope allows the token to be used with any database the IAM user or principal has been granted access to
+const dbTokenScope = "urn:oracle:db::id::*"
+
+// TokenProvider gets OCI IAM database tokens, to connect to an Autonomous Database (or another database
+// configured for IAM authentication) as an IAM user or principal, without a database password.
+// A new token is requested every time the exporter connects, and whenever the token of the connection pool expires.
+type TokenProvider struct {
+	provider common.ConfigurationProvider
+}
+
+// NewTokenProvider creates a TokenProvider that authenticates with OCI using the given method:
+// "config" uses the OCI config file (~/.oci/config, or the file in OCI_CONFIG_FILE) or the OCI_* environment variables,
+// "instance_principal" uses the instance principal of the compute instance the exporter runs on,
+// and "resource_principal" the resource principal, e.g. of an OKE workload or a function.
+func NewTokenProvider(method string) (*TokenProvider, error) {
+	var provider common.ConfigurationProvider
+	var err error
+	switch strings.ToLower(method) {
+	case "config", "true":
+		provider = common.DefaultConfigProvider()
+	case "instance_principal":
+		provider, err = auth.InstancePrincipalConfigurationProvider()
+	case "resource_principal":
+		provider, err = auth.ResourcePrincipalConfigurationProvider()
+	default:
+		return nil, fmt.Errorf("unknown OCI authentication method %q, expected config, instance_principal or resource_principal", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &TokenProvider{provider: provider}, nil
+}
+
+// GetToken requests a database token for a new key pair, and returns the token and the private key of the pair
+func (p *TokenProvider) GetToken(ctx context.Context) (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	privateKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	client, err := identitydataplane.NewDataplaneClientWithConfigurationProvider(p.provider)
+	if err != nil {
+		return "", "", err
+	}
+	req := identitydataplane.GenerateScopedAccessTokenRequest{
+		GenerateScopedAccessTokenDetails: identitydataplane.GenerateScopedAccessTokenDetails{
+			Scope:     common.String(dbTokenScope),
+			PublicKey: common.String(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))),
+		},
+	}
+	resp, err := client.GenerateScopedAccessToken(ctx, req)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to get a database token from OCI IAM: %w", err)
+	}
+	if resp.Token == nil {
+		return "", "", fmt.Errorf("OCI IAM did not return a database token")
+	}
+	// the Oracle client libraries take the private key without the PEM header and footer
+	return *resp.Token, b64.StdEncoding.EncodeToString(privateKey), nil
+}
@@ -6,12 +6,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"runtime/debug"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	cversion "github.com/prometheus/client_golang/prometheus/collectors/version"
@@ -29,6 +33,9 @@ import (
 
 	"github.com/oracle/oracle-db-appdev-monitoring/alertlog"
 	"github.com/oracle/oracle-db-appdev-monitoring/collector"
+	"github.com/oracle/oracle-db-appdev-monitoring/iam"
+	"github.com/oracle/oracle-db-appdev-monitoring/otlp"
+	"github.com/oracle/oracle-db-appdev-monitoring/remotewrite"
 	"github.com/oracle/oracle-db-appdev-monitoring/vault"
 )
 
@@ -36,14 +43,51 @@ var (
 	// Version will be set at build time.
 	Version            = "0.0.0.dev"
 	metricPath         = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics. (env: TELEMETRY_PATH)").Default(getEnv("TELEMETRY_PATH", "/metrics")).String()
-	defaultFileMetrics = kingpin.Flag("default.metrics", "File with default metrics in a TOML file. (env: DEFAULT_METRICS)").Default(getEnv("DEFAULT_METRICS", "default-metrics.toml")).String()
-	customMetrics      = kingpin.Flag("custom.metrics", "Comma separated list of file(s) that contain various custom metrics in a TOML format. (env: CUSTOM_METRICS)").Default(getEnv("CUSTOM_METRICS", "")).String()
+	debugRows          = kingpin.Flag("web.debug-rows", "Enable the /debug/rows endpoint, which returns the rows of a metric's request as JSON, e.g. /debug/rows?context=sessions.").Default("false").Bool()
+	defaultFileMetrics = kingpin.Flag("default.metrics", "File with default metrics in a TOML or YAML file. (env: DEFAULT_METRICS)").Default(getEnv("DEFAULT_METRICS", "default-metrics.toml")).String()
+	customMetrics      = kingpin.Flag("custom.metrics", "Comma separated list of file(s) that contain various custom metrics in a TOML or YAML format, or directories of *.toml, *.yaml and *.yml files. (env: CUSTOM_METRICS)").Default(getEnv("CUSTOM_METRICS", "")).String()
+	validateMetrics    = kingpin.Flag("metrics.validate", "Validate the default and custom metrics files, then exit without connecting to the database.").Default("false").Bool()
+	metricsNamespace   = kingpin.Flag("metrics.namespace", "Prefix of the metric names. (env: METRICS_NAMESPACE)").Default(getEnv("METRICS_NAMESPACE", "oracledb")).String()
+	constLabels        = kingpin.Flag("metrics.constLabels", "Comma separated list of name=value labels added to every metric, e.g. region=us-ashburn-1,env=prod. (env: CONST_LABELS)").Default(getEnv("CONST_LABELS", "")).String()
+	includeCollectors  = kingpin.Flag("collectors.include", "Comma separated list of metric contexts to scrape, all metrics are scraped if empty. (env: COLLECTORS_INCLUDE)").Default(getEnv("COLLECTORS_INCLUDE", "")).String()
+	excludeCollectors  = kingpin.Flag("collectors.exclude", "Comma separated list of metric contexts not to scrape, e.g. tablespace. Takes precedence over collectors.include. (env: COLLECTORS_EXCLUDE)").Default(getEnv("COLLECTORS_EXCLUDE", "")).String()
+	sessionInitSQL     = kingpin.Flag("database.sessionInitSQL", "Semicolon separated list of SQL statements run on every new database connection, e.g. ALTER SESSION SET NLS_DATE_FORMAT='YYYY-MM-DD HH24:MI:SS'. (env: DATABASE_SESSIONINITSQL)").Default(getEnv("DATABASE_SESSIONINITSQL", "")).String()
 	queryTimeout       = kingpin.Flag("query.timeout", "Query timeout (in seconds). (env: QUERY_TIMEOUT)").Default(getEnv("QUERY_TIMEOUT", "5")).Int()
+	checkTNSAlias      = kingpin.Flag("database.checkTNSAlias", "Check at startup that a connect string alias is defined in tnsnames.ora in TNS_ADMIN, and log the available aliases if it is not. (env: DATABASE_CHECKTNSALIAS)").Default(getEnv("DATABASE_CHECKTNSALIAS", "false")).Bool()
+	emitLastValue      = kingpin.Flag("scrape.emitLastValueOnFailure", "Return the last scraped values of a metric when its scrape fails or the database is down, with their age in oracledb_exporter_last_value_age_seconds. (env: SCRAPE_EMITLASTVALUEONFAILURE)").Default(getEnv("SCRAPE_EMITLASTVALUEONFAILURE", "false")).Bool()
+	maxRows            = kingpin.Flag("scrape.maxRows", "Maximum number of rows a metric's request may return, beyond which the metric is skipped. 0 means no limit. (env: SCRAPE_MAXROWS)").Default(getEnv("SCRAPE_MAXROWS", "10000")).Int()
+	collectorInfo      = kingpin.Flag("metrics.collectorInfo", "Expose oracledb_exporter_collector_info, labeled with the file each metric context was loaded from. (env: METRICS_COLLECTORINFO)").Default(getEnv("METRICS_COLLECTORINFO", "false")).Bool()
+	initialWindow      = kingpin.Flag("scrape.initialWindow", "How far back a request using {{.LastScrapeTime}} queries the first time it runs. (env: SCRAPE_INITIALWINDOW)").Default(getEnv("SCRAPE_INITIALWINDOW", "1h")).Duration()
+	waitEvents         = kingpin.Flag("metrics.waitEvents", "Add the built-in wait_event metrics, with the total waits and time waited of the non-idle wait events with the most time waited. (env: METRICS_WAITEVENTS)").Default(getEnv("METRICS_WAITEVENTS", "false")).Bool()
+	waitEventLimit     = kingpin.Flag("metrics.waitEventLimit", "Number of wait events in the wait_event metrics. (env: METRICS_WAITEVENTLIMIT)").Default(getEnv("METRICS_WAITEVENTLIMIT", "20")).Int()
+	topSQL             = kingpin.Flag("metrics.topSQL", "Add the built-in top_sql_rank metrics, with the elapsed time, CPU time and executions of the statements with the most elapsed time, labeled by rank, and their sql_id in top_sql_rank_info. (env: METRICS_TOPSQL)").Default(getEnv("METRICS_TOPSQL", "false")).Bool()
+	topSQLLimit        = kingpin.Flag("metrics.topSQLLimit", "Number of statements in the top_sql_rank metrics. (env: METRICS_TOPSQLLIMIT)").Default(getEnv("METRICS_TOPSQLLIMIT", "10")).Int()
+	setModuleAction    = kingpin.Flag("database.setModuleAction", "Set the module of the session to oracledb_exporter and its action to the metric context for each query, so that the load of each metric can be told apart in v$session and AWR. (env: DATABASE_SETMODULEACTION)").Default(getEnv("DATABASE_SETMODULEACTION", "false")).Bool()
+	slowQueryThreshold = kingpin.Flag("scrape.slowQueryThreshold", "Log a warning when a metric's query takes longer than this, at most once an hour per metric. 0 disables it. (env: SCRAPE_SLOWQUERYTHRESHOLD)").Default(getEnv("SCRAPE_SLOWQUERYTHRESHOLD", "0s")).Duration()
+	warmupScrape       = kingpin.Flag("scrape.warmup", "Run one scrape in the background at startup, so that the first scrape by Prometheus is served its results instead of waiting for the database. Only used when scrape.interval is 0. (env: SCRAPE_WARMUP)").Default(getEnv("SCRAPE_WARMUP", "false")).Bool()
+	capturePlans       = kingpin.Flag("scrape.capturePlans", "Log the execution plan of a query slower than scrape.slowQueryThreshold, from DBMS_XPLAN. (env: SCRAPE_CAPTUREPLANS)").Default(getEnv("SCRAPE_CAPTUREPLANS", "false")).Bool()
+	healthCheckQuery   = kingpin.Flag("database.healthCheckQuery", "Query run on each scrape to check that the database is up, with the query timeout. The database is pinged if empty. (env: DATABASE_HEALTHCHECKQUERY)").Default(getEnv("DATABASE_HEALTHCHECKQUERY", "select 1 from dual")).String()
 	maxIdleConns       = kingpin.Flag("database.maxIdleConns", "Number of maximum idle connections in the connection pool. (env: DATABASE_MAXIDLECONNS)").Default(getEnv("DATABASE_MAXIDLECONNS", "0")).Int()
 	maxOpenConns       = kingpin.Flag("database.maxOpenConns", "Number of maximum open connections in the connection pool. (env: DATABASE_MAXOPENCONNS)").Default(getEnv("DATABASE_MAXOPENCONNS", "10")).Int()
+	connMaxLifetime    = kingpin.Flag("database.connMaxLifetime", "Maximum amount of time a connection may be reused, 0 for no limit. (env: DATABASE_CONNMAXLIFETIME)").Default(getEnv("DATABASE_CONNMAXLIFETIME", "0s")).Duration()
+	connMaxIdleTime    = kingpin.Flag("database.connMaxIdleTime", "Maximum amount of time a connection may be idle, 0 for no limit. (env: DATABASE_CONNMAXIDLETIME)").Default(getEnv("DATABASE_CONNMAXIDLETIME", "0s")).Duration()
+	connWaitTimeout    = kingpin.Flag("database.connectionWaitTimeout", "Maximum amount of time a metric's query waits for a free connection in the pool, counted separately from the query timeout. 0 counts the wait as part of the query timeout. (env: DATABASE_CONNECTIONWAITTIMEOUT)").Default(getEnv("DATABASE_CONNECTIONWAITTIMEOUT", "0s")).Duration()
+	reconnectRetries   = kingpin.Flag("database.reconnectMaxRetries", "Number of times the delay between reconnect attempts is doubled after the connection is lost, from 0 to 30. (env: DATABASE_RECONNECTMAXRETRIES)").Default(getEnv("DATABASE_RECONNECTMAXRETRIES", "3")).Int()
+	reconnectBackoff   = kingpin.Flag("database.reconnectBackoff", "Initial delay between reconnect attempts, doubled after each failed attempt up to 1h. Scrapes in the meantime do not try to reconnect. (env: DATABASE_RECONNECTBACKOFF)").Default(getEnv("DATABASE_RECONNECTBACKOFF", "1s")).Duration()
+	maxConcurrent      = kingpin.Flag("scrape.maxConcurrent", "Number of metric queries run at the same time during a scrape. (env: SCRAPE_MAXCONCURRENT)").Default(getEnv("SCRAPE_MAXCONCURRENT", "10")).Int()
+	targetsFile        = kingpin.Flag("database.targets", "File with the list of databases to monitor in a TOML format. If not set, the database in DB_CONNECT_STRING is monitored. (env: DATABASE_TARGETS)").Default(getEnv("DATABASE_TARGETS", "")).String()
+	targetsParallelism = kingpin.Flag("database.targetsParallelism", "Number of databases scraped at the same time when using scheduled scrapes. (env: DATABASE_TARGETSPARALLELISM)").Default(getEnv("DATABASE_TARGETSPARALLELISM", "4")).Int()
 	scrapeInterval     = kingpin.Flag("scrape.interval", "Interval between each scrape. Default is to scrape on collect requests.").Default("0s").Duration()
+	otlpEndpoint       = kingpin.Flag("otlp.endpoint", "OpenTelemetry collector OTLP/HTTP endpoint to push metrics to on each scrape interval, e.g. http://localhost:4318. Requires scrape.interval. (env: OTEL_EXPORTER_OTLP_ENDPOINT)").Default(getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")).String()
+	pushGateway        = kingpin.Flag("push.gateway", "Prometheus Pushgateway URL to push metrics to on each scrape interval, e.g. http://pushgateway:9091. Requires scrape.interval. (env: PUSHGATEWAY_URL)").Default(getEnv("PUSHGATEWAY_URL", "")).String()
+	pushJob            = kingpin.Flag("push.job", "Job name the metrics are pushed to the Pushgateway under. (env: PUSHGATEWAY_JOB)").Default(getEnv("PUSHGATEWAY_JOB", "oracledb_exporter")).String()
+	remoteWriteURL     = kingpin.Flag("remoteWrite.url", "Prometheus remote write URL to send metrics to on each scrape interval, e.g. https://mimir:9009/api/v1/push. Requires scrape.interval. Basic auth credentials are read from REMOTE_WRITE_USERNAME and REMOTE_WRITE_PASSWORD. (env: REMOTE_WRITE_URL)").Default(getEnv("REMOTE_WRITE_URL", "")).String()
+	remoteWriteLabels  = kingpin.Flag("remoteWrite.externalLabels", "Comma separated list of name=value labels added to every series sent to the remote write endpoint. job defaults to oracledb_exporter and instance to the host name. (env: REMOTE_WRITE_EXTERNAL_LABELS)").Default(getEnv("REMOTE_WRITE_EXTERNAL_LABELS", "")).String()
+	remoteWriteRetries = kingpin.Flag("remoteWrite.maxRetries", "Number of times a failed write to the remote write endpoint is retried. (env: REMOTE_WRITE_MAX_RETRIES)").Default(getEnv("REMOTE_WRITE_MAX_RETRIES", "3")).Int()
+	remoteWriteBackoff = kingpin.Flag("remoteWrite.backoff", "Initial delay between attempts to write to the remote write endpoint, doubled after each failed attempt. (env: REMOTE_WRITE_BACKOFF)").Default(getEnv("REMOTE_WRITE_BACKOFF", "1s")).Duration()
 	logDisable         = kingpin.Flag("log.disable", "Set to 1 to disable alert logs").Default("0").Int()
 	logInterval        = kingpin.Flag("log.interval", "Interval between log updates (e.g. 5s).").Default("15s").Duration()
+	redactPatterns     = kingpin.Flag("log.redactPattern", "Regular expression matching text that is replaced with *** in the SQL and bind values that are logged, e.g. a password in a comment of a request. Can be repeated. (env: LOG_REDACTPATTERN)").Default(getEnv("LOG_REDACTPATTERN", "")).Strings()
 	logDestination     = kingpin.Flag("log.destination", "File to output the alert log to. (env: LOG_DESTINATION)").Default(getEnv("LOG_DESTINATION", "/log/alert.log")).String()
 	toolkitFlags       = webflag.AddFlags(kingpin.CommandLine, ":9161")
 )
@@ -55,18 +99,52 @@ func main() {
 	kingpin.Version(version.Print("oracledb_exporter"))
 	kingpin.Parse()
 	logger := promlog.New(promLogConfig)
+
+	if *validateMetrics {
+		if !validateMetricsFiles(logger) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	user := os.Getenv("DB_USERNAME")
 	password := os.Getenv("DB_PASSWORD")
+	passwordFile := os.Getenv("DB_PASSWORD_FILE")
+	proxyUser := os.Getenv("DB_PROXY_USER")
 	connectString := os.Getenv("DB_CONNECT_STRING")
 	dbrole := os.Getenv("DB_ROLE")
 	tnsadmin := os.Getenv("TNS_ADMIN")
-	// externalAuth - Default to user/password but if no password is supplied then will automagically set to true
-	externalAuth := false
+	walletLocation := os.Getenv("DB_WALLET_LOCATION")
+	// externalAuth - Default to user/password but if no password is supplied then will automagically set to true.
+	// DB_EXTERNAL_AUTH=true uses external authentication even if a user is given, e.g. for Kerberos
+	externalAuth := strings.EqualFold(os.Getenv("DB_EXTERNAL_AUTH"), "true")
+	// the Kerberos credential cache is read by the Oracle client libraries from the environment of the process
+	if kerberosCCache := os.Getenv("DB_KERBEROS_CCACHE"); kerberosCCache != "" {
+		level.Info(logger).Log("msg", "Using Kerberos credential cache", "ccache", kerberosCCache)
+		os.Setenv("KRB5CCNAME", kerberosCCache)
+	}
+	webAuthUser := os.Getenv("WEB_AUTH_USER")
+	webAuthPasswordFile := os.Getenv("WEB_AUTH_PASSWORD_FILE")
+	webBearerTokenFile := os.Getenv("WEB_BEARER_TOKEN_FILE")
 
+	// the password is read from the vault every time the exporter connects, so that rotations are picked up
+	var secretProvider collector.SecretProvider
 	vaultID, useVault := os.LookupEnv("OCI_VAULT_ID")
 	if useVault {
 		level.Info(logger).Log("msg", "OCI_VAULT_ID env var is present so using OCI Vault", "vaultOCID", vaultID)
-		password = vault.GetVaultSecret(vaultID, os.Getenv("OCI_VAULT_SECRET_NAME"))
+		secretProvider = vault.NewSecretProvider(vaultID, os.Getenv("OCI_VAULT_SECRET_NAME"))
+	}
+
+	// DB_IAM_TOKEN_AUTH connects with an OCI IAM database token, e.g. to an Autonomous Database, instead of a password
+	var tokenProvider collector.TokenProvider
+	if method := os.Getenv("DB_IAM_TOKEN_AUTH"); method != "" {
+		level.Info(logger).Log("msg", "DB_IAM_TOKEN_AUTH env var is present so using OCI IAM database tokens", "method", method)
+		provider, err := iam.NewTokenProvider(method)
+		if err != nil {
+			level.Error(logger).Log("msg", "unable to set up OCI IAM token authentication", "error", err)
+			os.Exit(1)
+		}
+		tokenProvider = provider
 	}
 
 	freeOSMemInterval, enableFree := os.LookupEnv("FREE_INTERVAL")
@@ -83,33 +161,171 @@ func main() {
 		level.Info(logger).Log("msg", "RESTART_INTERVAL env var is not present, so will not restart myself periodically")
 	}
 
-	config := &collector.Config{
-		User:               user,
-		Password:           password,
-		ConnectString:      connectString,
-		DbRole:             dbrole,
-		ConfigDir:          tnsadmin,
-		ExternalAuth:		externalAuth,
-		MaxOpenConns:       *maxOpenConns,
-		MaxIdleConns:       *maxIdleConns,
-		CustomMetrics:      *customMetrics,
-		QueryTimeout:       *queryTimeout,
-		DefaultMetricsFile: *defaultFileMetrics,
-	}
-	exporter, err := collector.NewExporter(logger, config)
+	labels, err := parseConstLabels(*constLabels)
 	if err != nil {
-		level.Error(logger).Log("msg", "unable to connect to DB", "error", err)
+		level.Error(logger).Log("msg", "invalid metrics.constLabels", "error", err)
+		os.Exit(1)
 	}
 
-	if *scrapeInterval != 0 {
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		go exporter.RunScheduledScrapes(ctx, *scrapeInterval)
+	config := &collector.Config{
+		User:                   user,
+		ProxyUser:              proxyUser,
+		Password:               password,
+		PasswordFile:           passwordFile,
+		SecretProvider:         secretProvider,
+		TokenProvider:          tokenProvider,
+		ConnectString:          connectString,
+		DbRole:                 dbrole,
+		ConfigDir:              tnsadmin,
+		WalletLocation:         walletLocation,
+		ExternalAuth:           externalAuth,
+		WebAuthUser:            webAuthUser,
+		WebAuthPasswordFile:    webAuthPasswordFile,
+		WebBearerTokenFile:     webBearerTokenFile,
+		CollectorInfo:          *collectorInfo,
+		InitialWindow:          *initialWindow,
+		WaitEventMetrics:       *waitEvents,
+		WaitEventLimit:         *waitEventLimit,
+		TopSQLMetrics:          *topSQL,
+		TopSQLLimit:            *topSQLLimit,
+		SetModuleAction:        *setModuleAction,
+		SlowQueryThreshold:     *slowQueryThreshold,
+		CapturePlans:           *capturePlans,
+		WarmupScrape:           *warmupScrape && *scrapeInterval == 0,
+		RedactPatterns:         *redactPatterns,
+		MaxOpenConns:           *maxOpenConns,
+		MaxIdleConns:           *maxIdleConns,
+		ConnMaxLifetime:        *connMaxLifetime,
+		ConnMaxIdleTime:        *connMaxIdleTime,
+		ConnectionWaitTimeout:  *connWaitTimeout,
+		MaxConcurrentScrapes:   *maxConcurrent,
+		LogFormat:              promLogConfig.Format.String(),
+		MetricsNamespace:       *metricsNamespace,
+		ConstLabels:            labels,
+		IncludeCollectors:      splitList(*includeCollectors),
+		ExcludeCollectors:      splitList(*excludeCollectors),
+		SessionInitSQL:         parseSessionInitSQL(*sessionInitSQL),
+		PushgatewayURL:         *pushGateway,
+		PushgatewayJob:         *pushJob,
+		CustomMetrics:          *customMetrics,
+		QueryTimeout:           *queryTimeout,
+		HealthCheckQuery:       *healthCheckQuery,
+		CheckTNSAlias:          *checkTNSAlias,
+		MaxRows:                *maxRows,
+		EmitLastValueOnFailure: *emitLastValue,
+		DefaultMetricsFile:     *defaultFileMetrics,
+		ReconnectMaxRetries:    *reconnectRetries,
+		ReconnectBackoff:       *reconnectBackoff,
 	}
+	if *pushGateway != "" && *scrapeInterval == 0 {
+		level.Error(logger).Log("msg", "push.gateway requires scrape.interval to be set")
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	prometheus.MustRegister(exporter)
+	var exporter *collector.Exporter
+	var reloader interface{ ReloadMetrics() error }
+	var readiness interface{ Ready(context.Context) error }
+	var queryRows func(ctx context.Context, database, metricContext string) ([]map[string]string, error)
+	var loadedMetrics func(database string) ([]collector.Metric, error)
+	if *targetsFile != "" {
+		targets, err := collector.LoadTargets(*targetsFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "unable to load database targets", "file", *targetsFile, "error", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "Monitoring multiple databases", "targets", len(targets))
+		multiExporter, err := collector.NewMultiExporter(logger, config, targets, *targetsParallelism)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid exporter configuration", "error", err)
+			os.Exit(1)
+		}
+		if *scrapeInterval != 0 {
+			go multiExporter.RunScheduledScrapes(ctx, *scrapeInterval)
+		}
+		if err := multiExporter.Register(prometheus.DefaultRegisterer); err != nil {
+			level.Error(logger).Log("msg", "unable to register database targets", "error", err)
+			os.Exit(1)
+		}
+		reloader = multiExporter
+		readiness = multiExporter
+		queryRows = multiExporter.QueryRows
+		loadedMetrics = multiExporter.LoadedMetrics
+	} else {
+		var err error
+		exporter, err = collector.NewExporter(logger, config)
+		if exporter == nil {
+			level.Error(logger).Log("msg", "invalid exporter configuration", "error", err)
+			os.Exit(1)
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "unable to connect to DB", "error", err)
+		}
+
+		if *scrapeInterval != 0 {
+			go exporter.RunScheduledScrapes(ctx, *scrapeInterval)
+		}
+
+		prometheus.MustRegister(exporter)
+		reloader = exporter
+		readiness = exporter
+		queryRows = func(ctx context.Context, _, metricContext string) ([]map[string]string, error) {
+			return exporter.QueryRows(ctx, metricContext)
+		}
+		loadedMetrics = func(_ string) ([]collector.Metric, error) {
+			return exporter.LoadedMetrics(), nil
+		}
+	}
 	prometheus.MustRegister(cversion.NewCollector("oracledb_exporter"))
 
+	if *otlpEndpoint != "" {
+		if *scrapeInterval == 0 {
+			level.Error(logger).Log("msg", "otlp.endpoint requires scrape.interval to be set")
+			os.Exit(1)
+		}
+		resource := map[string]string{
+			"service.name":    "oracledb_exporter",
+			"service.version": Version,
+		}
+		if exporter != nil && exporter.ServiceName() != "" {
+			resource["db.namespace"] = exporter.ServiceName()
+		}
+		level.Info(logger).Log("msg", "Pushing metrics to OTLP endpoint", "endpoint", *otlpEndpoint)
+		go otlp.NewPusher(*otlpEndpoint, prometheus.DefaultGatherer, resource, logger).Run(ctx, *scrapeInterval)
+	}
+
+	if *remoteWriteURL != "" {
+		if *scrapeInterval == 0 {
+			level.Error(logger).Log("msg", "remoteWrite.url requires scrape.interval to be set")
+			os.Exit(1)
+		}
+		if *remoteWriteRetries < 0 || *remoteWriteBackoff < 0 {
+			level.Error(logger).Log("msg", "remoteWrite.maxRetries and remoteWrite.backoff cannot be negative")
+			os.Exit(1)
+		}
+		// as when Prometheus scrapes the exporter, the series are labeled with the job and instance they came from
+		externalLabels, err := parseConstLabels(*remoteWriteLabels)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid remoteWrite.externalLabels", "error", err)
+			os.Exit(1)
+		}
+		if _, ok := externalLabels["job"]; !ok {
+			externalLabels["job"] = "oracledb_exporter"
+		}
+		if _, ok := externalLabels["instance"]; !ok {
+			if hostname, err := os.Hostname(); err == nil {
+				externalLabels["instance"] = hostname
+			}
+		}
+		level.Info(logger).Log("msg", "Sending metrics to remote write endpoint", "url", *remoteWriteURL)
+		writer := remotewrite.NewWriter(*remoteWriteURL, os.Getenv("REMOTE_WRITE_USERNAME"), os.Getenv("REMOTE_WRITE_PASSWORD"),
+			prometheus.DefaultGatherer, *remoteWriteRetries, *remoteWriteBackoff, *metricsNamespace, externalLabels, logger)
+		prometheus.MustRegister(writer)
+		go writer.Run(ctx, *scrapeInterval)
+	}
+
 	level.Info(logger).Log("msg", "Starting oracledb_exporter", "version", Version)
 	level.Info(logger).Log("msg", "Build context", "build", version.BuildContext())
 	level.Info(logger).Log("msg", "Collect from: ", "metricPath", *metricPath)
@@ -117,7 +333,48 @@ func main() {
 	opts := promhttp.HandlerOpts{
 		ErrorHandling: promhttp.ContinueOnError,
 	}
-	http.Handle(*metricPath, promhttp.HandlerFor(prometheus.DefaultGatherer, opts))
+	// the endpoints that expose data or change the exporter need authentication if it is configured, but /readyz doesn't
+	http.Handle(*metricPath, collector.WithAuth(config, logger, promhttp.HandlerFor(prometheus.DefaultGatherer, opts)))
+	http.Handle("/-/reload", collector.WithAuth(config, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		level.Info(logger).Log("msg", "Reloading metrics definitions")
+		if err := reloader.ReloadMetrics(); err != nil {
+			level.Error(logger).Log("msg", "Error reloading metrics definitions", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})))
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := readiness.Ready(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	// the database parameter selects the target when monitoring multiple databases
+	http.Handle("/collectors", collector.WithAuth(config, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := loadedMetrics(r.URL.Query().Get("database"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metrics)
+	})))
+	if *debugRows {
+		// the database parameter selects the target when monitoring multiple databases
+		http.Handle("/debug/rows", collector.WithAuth(config, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rows, err := queryRows(r.Context(), r.URL.Query().Get("database"), r.URL.Query().Get("context"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rows)
+		})))
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("<html><head><title>Oracle DB Exporter " + Version + "</title></head><body><h1>Oracle DB Exporter " + Version + "</h1><p><a href='" + *metricPath + "'>Metrics</a></p></body></html>"))
 	})
@@ -164,6 +421,8 @@ func main() {
 	// start the log exporter
 	if *logDisable == 1 {
 		level.Info(logger).Log("msg", "log.disable set to 1, so will not export the alert logs")
+	} else if exporter == nil {
+		level.Info(logger).Log("msg", "alert logs are not exported when monitoring multiple databases")
 	} else {
 		level.Info(logger).Log("msg", "Exporting alert logs to "+*logDestination)
 		logTicker := time.NewTicker(*logInterval)
@@ -187,6 +446,69 @@ func main() {
 
 }
 
+// validateMetricsFiles checks the default and custom metrics files, logging every problem found
+func validateMetricsFiles(logger log.Logger) bool {
+	files := []string{}
+	if *defaultFileMetrics != "" {
+		files = append(files, *defaultFileMetrics)
+	}
+	customFiles, err := collector.CustomMetricsFiles(*customMetrics)
+	if err != nil {
+		level.Error(logger).Log("msg", "Unable to list custom metrics files", "error", err)
+		return false
+	}
+	files = append(files, customFiles...)
+	valid := true
+	for _, file := range files {
+		metrics, err := collector.ValidateMetricsFile(file)
+		if err != nil {
+			level.Error(logger).Log("msg", "Metrics file is not valid", "file", file, "error", err)
+			valid = false
+			continue
+		}
+		level.Info(logger).Log("msg", "Metrics file is valid", "file", file, "metrics", len(metrics))
+	}
+	return valid
+}
+
+// parseConstLabels parses a comma separated list of name=value labels, ignoring empty entries
+func parseConstLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, label := range strings.Split(s, ",") {
+		if strings.TrimSpace(label) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(label, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %q is not in the form name=value", strings.TrimSpace(label))
+		}
+		labels[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// splitList splits a comma separated list, ignoring empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseSessionInitSQL splits a semicolon separated list of SQL statements
+func parseSessionInitSQL(s string) []string {
+	var stmts []string
+	for _, stmt := range strings.Split(s, ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
 // getEnv returns the value of an environment variable, or returns the provided fallback value
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
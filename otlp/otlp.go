@@ -0,0 +1,326 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Pusher periodically pushes the metrics of a prometheus.Gatherer to an OpenTelemetry collector,
+// using OTLP over HTTP with the JSON encoding.
+type Pusher struct {
+	url       string
+	gatherer  prometheus.Gatherer
+	resource  map[string]string
+	client    *http.Client
+	logger    log.Logger
+	startTime time.Time
+}
+
+// NewPusher creates a Pusher for the OTLP/HTTP endpoint, e.g. http://otel-collector:4318.
+// The resource attributes are added to every push, e.g. service.name.
+func NewPusher(endpoint string, gatherer prometheus.Gatherer, resource map[string]string, logger log.Logger) *Pusher {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/metrics") {
+		url += "/v1/metrics"
+	}
+	return &Pusher{
+		url:       url,
+		gatherer:  gatherer,
+		resource:  resource,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		logger:    logger,
+		startTime: time.Now(),
+	}
+}
+
+// Run pushes the metrics on every interval until the context is cancelled
+func (p *Pusher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Push(ctx); err != nil {
+				level.Error(p.logger).Log("msg", "Error pushing metrics to OTLP endpoint", "url", p.url, "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Push gathers the metrics and sends them to the OTLP endpoint
+func (p *Pusher) Push(ctx context.Context) error {
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		// gather errors are partial, send what was gathered
+		level.Debug(p.logger).Log("msg", "Error gathering some metrics", "error", err)
+	}
+	body, err := json.Marshal(p.toRequest(mfs, time.Now()))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OTLP endpoint returned %s: %s", resp.Status, msg)
+	}
+	level.Debug(p.logger).Log("msg", "Pushed metrics to OTLP endpoint", "url", p.url, "families", len(mfs))
+	return nil
+}
+
+// The types below are the JSON encoding of the OTLP ExportMetricsServiceRequest.
+// 64 bit integers are encoded as strings, as required by the protobuf JSON mapping.
+
+type exportRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type metric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *gauge     `json:"gauge,omitempty"`
+	Sum         *sum       `json:"sum,omitempty"`
+	Histogram   *histogram `json:"histogram,omitempty"`
+	Summary     *summary   `json:"summary,omitempty"`
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type summary struct {
+	DataPoints []summaryDataPoint `json:"dataPoints"`
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsDouble          double     `json:"asDouble"`
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               double     `json:"sum"`
+	BucketCounts      []string   `json:"bucketCounts"`
+	ExplicitBounds    []double   `json:"explicitBounds"`
+}
+
+type summaryDataPoint struct {
+	Attributes        []keyValue      `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               double          `json:"sum"`
+	QuantileValues    []quantileValue `json:"quantileValues"`
+}
+
+type quantileValue struct {
+	Quantile double `json:"quantile"`
+	Value    double `json:"value"`
+}
+
+// aggregationTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE, as Prometheus counters and histograms are cumulative
+const aggregationTemporalityCumulative = 2
+
+// double is a float64 that encodes NaN and infinities the way the protobuf JSON mapping expects
+type double float64
+
+func (d double) MarshalJSON() ([]byte, error) {
+	f := float64(d)
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(f, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(f, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+	return json.Marshal(f)
+}
+
+func (p *Pusher) toRequest(mfs []*dto.MetricFamily, now time.Time) exportRequest {
+	start := strconv.FormatInt(p.startTime.UnixNano(), 10)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	metrics := make([]metric, 0, len(mfs))
+	for _, mf := range mfs {
+		m := metric{Name: mf.GetName(), Description: mf.GetHelp()}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			m.Sum = &sum{AggregationTemporality: aggregationTemporalityCumulative, IsMonotonic: true}
+			for _, pm := range mf.GetMetric() {
+				m.Sum.DataPoints = append(m.Sum.DataPoints, numberDataPoint{
+					Attributes:        toAttributes(pm.GetLabel()),
+					StartTimeUnixNano: start,
+					TimeUnixNano:      ts,
+					AsDouble:          double(pm.GetCounter().GetValue()),
+				})
+			}
+		case dto.MetricType_HISTOGRAM:
+			m.Histogram = &histogram{AggregationTemporality: aggregationTemporalityCumulative}
+			for _, pm := range mf.GetMetric() {
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, toHistogramDataPoint(pm, start, ts))
+			}
+		case dto.MetricType_SUMMARY:
+			m.Summary = &summary{}
+			for _, pm := range mf.GetMetric() {
+				dp := summaryDataPoint{
+					Attributes:        toAttributes(pm.GetLabel()),
+					StartTimeUnixNano: start,
+					TimeUnixNano:      ts,
+					Count:             strconv.FormatUint(pm.GetSummary().GetSampleCount(), 10),
+					Sum:               double(pm.GetSummary().GetSampleSum()),
+					QuantileValues:    []quantileValue{},
+				}
+				for _, q := range pm.GetSummary().GetQuantile() {
+					dp.QuantileValues = append(dp.QuantileValues, quantileValue{
+						Quantile: double(q.GetQuantile()),
+						Value:    double(q.GetValue()),
+					})
+				}
+				m.Summary.DataPoints = append(m.Summary.DataPoints, dp)
+			}
+		default:
+			// gauges and untyped metrics
+			m.Gauge = &gauge{}
+			for _, pm := range mf.GetMetric() {
+				value := pm.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_UNTYPED {
+					value = pm.GetUntyped().GetValue()
+				}
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, numberDataPoint{
+					Attributes:   toAttributes(pm.GetLabel()),
+					TimeUnixNano: ts,
+					AsDouble:     double(value),
+				})
+			}
+		}
+		metrics = append(metrics, m)
+	}
+
+	return exportRequest{ResourceMetrics: []resourceMetrics{{
+		Resource:     resource{Attributes: toResourceAttributes(p.resource)},
+		ScopeMetrics: []scopeMetrics{{Scope: scope{Name: "oracledb_exporter"}, Metrics: metrics}},
+	}}}
+}
+
+// toHistogramDataPoint converts the cumulative Prometheus buckets into the per-bucket counts used by OTLP
+func toHistogramDataPoint(pm *dto.Metric, start, ts string) histogramDataPoint {
+	h := pm.GetHistogram()
+	dp := histogramDataPoint{
+		Attributes:        toAttributes(pm.GetLabel()),
+		StartTimeUnixNano: start,
+		TimeUnixNano:      ts,
+		Count:             strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:               double(h.GetSampleSum()),
+		BucketCounts:      []string{},
+		ExplicitBounds:    []double{},
+	}
+	var previous uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		dp.ExplicitBounds = append(dp.ExplicitBounds, double(b.GetUpperBound()))
+		dp.BucketCounts = append(dp.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-previous, 10))
+		previous = b.GetCumulativeCount()
+	}
+	// the last bucket counts everything above the highest bound
+	var overflow uint64
+	if h.GetSampleCount() > previous {
+		overflow = h.GetSampleCount() - previous
+	}
+	dp.BucketCounts = append(dp.BucketCounts, strconv.FormatUint(overflow, 10))
+	return dp
+}
+
+func toAttributes(labels []*dto.LabelPair) []keyValue {
+	attributes := make([]keyValue, 0, len(labels))
+	for _, l := range labels {
+		attributes = append(attributes, keyValue{Key: l.GetName(), Value: anyValue{StringValue: l.GetValue()}})
+	}
+	return attributes
+}
+
+func toResourceAttributes(resource map[string]string) []keyValue {
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attributes := make([]keyValue, 0, len(keys))
+	for _, k := range keys {
+		attributes = append(attributes, keyValue{Key: k, Value: anyValue{StringValue: resource[k]}})
+	}
+	return attributes
+}
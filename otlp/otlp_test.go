@@ -0,0 +1,151 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// constMetrics is a collector of fixed metrics, to gather them with a registry
+type constMetrics []prometheus.Metric
+
+func (ms constMetrics) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(ms, ch)
+}
+
+func (ms constMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range ms {
+		ch <- m
+	}
+}
+
+// replaceTimes checks that the timestamps of a decoded payload are 64 bit integers encoded as strings, with the
+// start time the one given, and replaces them with "start" and "now" so that the payload can be compared
+func replaceTimes(t *testing.T, v any, start string) {
+	t.Helper()
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			switch key {
+			case "startTimeUnixNano":
+				if value != start {
+					t.Errorf("startTimeUnixNano = %v, want %q", value, start)
+				}
+				v[key] = "start"
+			case "timeUnixNano":
+				s, ok := value.(string)
+				if _, err := strconv.ParseInt(s, 10, 64); !ok || err != nil {
+					t.Errorf("timeUnixNano = %v, want an integer encoded as a string", value)
+				}
+				v[key] = "now"
+			default:
+				replaceTimes(t, value, start)
+			}
+		}
+	case []any:
+		for _, value := range v {
+			replaceTimes(t, value, start)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, labels, nil)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(constMetrics{
+		prometheus.MustNewConstMetric(desc("oracledb_activity_execute_count", "Executions."), prometheus.CounterValue, 1234),
+		prometheus.MustNewConstMetric(desc("oracledb_sessions_value", "Sessions.", "status"), prometheus.GaugeValue, 3, "ACTIVE"),
+		prometheus.MustNewConstMetric(desc("oracledb_sessions_value", "Sessions.", "status"), prometheus.GaugeValue, math.NaN(), "KILLED"),
+		prometheus.MustNewConstMetric(desc("oracledb_sessions_value", "Sessions.", "status"), prometheus.GaugeValue, math.Inf(1), "SNIPED"),
+		prometheus.MustNewConstHistogram(desc("oracledb_query_seconds", "Query time.", "sql_id"),
+			5, 12.5, map[float64]uint64{1: 2, 10: 4}, "abc"),
+		prometheus.MustNewConstSummary(desc("oracledb_wait_seconds", "Wait time."),
+			7, math.Inf(-1), map[float64]float64{0.5: 0.2, 0.99: 1.5}),
+	})
+
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			t.Errorf("pushed to %s, want /v1/metrics", r.URL.Path)
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %s, want application/json", r.Header.Get("Content-Type"))
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	p := NewPusher(server.URL+"/", registry, map[string]string{"service.name": "oracledb_exporter", "host.name": "exporter-host"}, log.NewNopLogger())
+	p.startTime = time.Unix(1760620455, 0)
+	if err := p.Push(context.Background()); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	var got any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("the payload is not JSON: %v\n%s", err, body)
+	}
+	replaceTimes(t, got, "1760620455000000000")
+	var want any
+	if err := json.Unmarshal([]byte(`{"resourceMetrics": [{
+		"resource": {"attributes": [
+			{"key": "host.name", "value": {"stringValue": "exporter-host"}},
+			{"key": "service.name", "value": {"stringValue": "oracledb_exporter"}}
+		]},
+		"scopeMetrics": [{"scope": {"name": "oracledb_exporter"}, "metrics": [
+			{"name": "oracledb_activity_execute_count", "description": "Executions.", "sum": {
+				"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": [
+					{"attributes": [], "startTimeUnixNano": "start", "timeUnixNano": "now", "asDouble": 1234}
+				]}},
+			{"name": "oracledb_query_seconds", "description": "Query time.", "histogram": {
+				"aggregationTemporality": 2, "dataPoints": [
+					{"attributes": [{"key": "sql_id", "value": {"stringValue": "abc"}}],
+					 "startTimeUnixNano": "start", "timeUnixNano": "now", "count": "5", "sum": 12.5,
+					 "bucketCounts": ["2", "2", "1"], "explicitBounds": [1, 10]}
+				]}},
+			{"name": "oracledb_sessions_value", "description": "Sessions.", "gauge": {"dataPoints": [
+				{"attributes": [{"key": "status", "value": {"stringValue": "ACTIVE"}}], "timeUnixNano": "now", "asDouble": 3},
+				{"attributes": [{"key": "status", "value": {"stringValue": "KILLED"}}], "timeUnixNano": "now", "asDouble": "NaN"},
+				{"attributes": [{"key": "status", "value": {"stringValue": "SNIPED"}}], "timeUnixNano": "now", "asDouble": "Infinity"}
+			]}},
+			{"name": "oracledb_wait_seconds", "description": "Wait time.", "summary": {"dataPoints": [
+				{"attributes": [], "startTimeUnixNano": "start", "timeUnixNano": "now", "count": "7", "sum": "-Infinity",
+				 "quantileValues": [{"quantile": 0.5, "value": 0.2}, {"quantile": 0.99, "value": 1.5}]}
+			]}}
+		]}]
+	}]}`), &want); err != nil {
+		t.Fatalf("the expected payload is not JSON: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("pushed\n%s\nwant\n%s", gotJSON, wantJSON)
+	}
+}
+
+func TestPushError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	p := NewPusher(server.URL+"/v1/metrics", prometheus.NewRegistry(), nil, log.NewNopLogger())
+	if err := p.Push(context.Background()); err == nil {
+		t.Error("Push did not return the error of the endpoint")
+	}
+}
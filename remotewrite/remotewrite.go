@@ -0,0 +1,251 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Writer periodically sends the metrics of a prometheus.Gatherer to a Prometheus remote write endpoint,
+// e.g. Grafana Cloud or Mimir, as a snappy compressed protobuf WriteRequest.
+type Writer struct {
+	url        string
+	username   string
+	password   string
+	gatherer   prometheus.Gatherer
+	client     *http.Client
+	logger     log.Logger
+	maxRetries int
+	backoff    time.Duration
+	failures   prometheus.Counter
+	// externalLabels are added to every series that doesn't already have a label of the same name
+	externalLabels []label
+}
+
+// NewWriter creates a Writer for the remote write URL. Basic authentication is used if username is not empty.
+// A failed write is retried up to maxRetries times, with the delay between attempts starting at backoff and doubling each time.
+// externalLabels, e.g. job and instance, are added to every series sent, as Prometheus does when it scrapes the exporter,
+// and namespace is the prefix of the exporter's own failures metric.
+func NewWriter(url, username, password string, gatherer prometheus.Gatherer, maxRetries int, backoff time.Duration,
+	namespace string, externalLabels map[string]string, logger log.Logger) *Writer {
+	external := make([]label, 0, len(externalLabels))
+	for name, value := range externalLabels {
+		external = append(external, label{name, value})
+	}
+	return &Writer{
+		url:            url,
+		username:       username,
+		password:       password,
+		gatherer:       gatherer,
+		client:         &http.Client{Timeout: 30 * time.Second},
+		logger:         logger,
+		maxRetries:     maxRetries,
+		backoff:        backoff,
+		externalLabels: external,
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "remote_write_failures_total",
+			Help:      "Total number of failed attempts to send metrics to the remote write endpoint.",
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector, so that the failures counter can be registered
+func (w *Writer) Describe(ch chan<- *prometheus.Desc) {
+	w.failures.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (w *Writer) Collect(ch chan<- prometheus.Metric) {
+	w.failures.Collect(ch)
+}
+
+// Run writes the metrics on every interval until the context is cancelled
+func (w *Writer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.WriteWithRetry(ctx); err != nil {
+				level.Error(w.logger).Log("msg", "Error sending metrics to remote write endpoint", "url", w.url, "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// WriteWithRetry gathers the metrics once and sends them, retrying with backoff if the write fails
+func (w *Writer) WriteWithRetry(ctx context.Context) error {
+	mfs, err := w.gatherer.Gather()
+	if err != nil {
+		// gather errors are partial, send what was gathered
+		level.Debug(w.logger).Log("msg", "Error gathering some metrics", "error", err)
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(mfs, w.externalLabels, time.Now()))
+
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		if err = w.write(ctx, body); err == nil {
+			level.Debug(w.logger).Log("msg", "Sent metrics to remote write endpoint", "url", w.url, "families", len(mfs))
+			return nil
+		}
+		w.failures.Inc()
+		if attempt >= w.maxRetries {
+			return err
+		}
+		level.Info(w.logger).Log("msg", "Waiting before retrying remote write", "attempt", attempt+1, "delay", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (w *Writer) write(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("remote write endpoint returned %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// label is a name and value pair of a time series
+type label struct {
+	name, value string
+}
+
+// encodeWriteRequest encodes the metric families as a prometheus.WriteRequest protobuf message:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+//
+// Histograms and summaries are split into their _bucket, _sum and _count series, as in the text format.
+// The external labels are added to each series, unless the metric has a label of the same name.
+func encodeWriteRequest(mfs []*dto.MetricFamily, externalLabels []label, now time.Time) []byte {
+	ts := now.UnixMilli()
+	var b []byte
+	add := func(name string, labels []label, value float64) {
+		series := encodeTimeSeries(name, labels, value, ts)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, series)
+	}
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, pm := range mf.GetMetric() {
+			labels := make([]label, 0, len(pm.GetLabel())+len(externalLabels)+1)
+			for _, l := range pm.GetLabel() {
+				labels = append(labels, label{l.GetName(), l.GetValue()})
+			}
+			for _, external := range externalLabels {
+				if !slices.ContainsFunc(pm.GetLabel(), func(l *dto.LabelPair) bool { return l.GetName() == external.name }) {
+					labels = append(labels, external)
+				}
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, labels, pm.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, labels, pm.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := pm.GetHistogram()
+				infSeen := false
+				for _, bucket := range h.GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						infSeen = true
+					}
+					add(name+"_bucket", append(labels, label{"le", formatFloat(bucket.GetUpperBound())}), float64(bucket.GetCumulativeCount()))
+				}
+				if !infSeen {
+					add(name+"_bucket", append(labels, label{"le", "+Inf"}), float64(h.GetSampleCount()))
+				}
+				add(name+"_sum", labels, h.GetSampleSum())
+				add(name+"_count", labels, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := pm.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, append(labels, label{"quantile", formatFloat(q.GetQuantile())}), q.GetValue())
+				}
+				add(name+"_sum", labels, s.GetSampleSum())
+				add(name+"_count", labels, float64(s.GetSampleCount()))
+			default:
+				add(name, labels, pm.GetUntyped().GetValue())
+			}
+		}
+	}
+	return b
+}
+
+// encodeTimeSeries encodes a TimeSeries with a single sample. Remote write requires the labels sorted by name.
+func encodeTimeSeries(name string, labels []label, value float64, ts int64) []byte {
+	all := make([]label, 0, len(labels)+1)
+	all = append(all, label{"__name__", name})
+	all = append(all, labels...)
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+
+	var b []byte
+	for _, l := range all {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, lb)
+	}
+	var sb []byte
+	sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+	sb = protowire.AppendFixed64(sb, math.Float64bits(value))
+	sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+	sb = protowire.AppendVarint(sb, uint64(ts))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, sb)
+	return b
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2025, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// constMetrics is a collector of fixed metrics, to gather them with a registry
+type constMetrics []prometheus.Metric
+
+func (ms constMetrics) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(ms, ch)
+}
+
+func (ms constMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range ms {
+		ch <- m
+	}
+}
+
+// series is a decoded TimeSeries with a single sample
+type series struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+// String formats the series as in the text format, with the labels in the order they were encoded
+func (s series) String() string {
+	var name string
+	var labels []string
+	for _, l := range s.labels {
+		if l.name == "__name__" {
+			name = l.value
+			continue
+		}
+		labels = append(labels, l.name+"=\""+l.value+"\"")
+	}
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// consumeFields calls field with the number, type and value of each field of a protobuf message
+func consumeFields(t *testing.T, b []byte, field func(num protowire.Number, typ protowire.Type, v []byte)) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+		}
+		field(num, typ, b[:n])
+		b = b[n:]
+	}
+}
+
+// decodeWriteRequest decodes a WriteRequest encoded by encodeWriteRequest
+func decodeWriteRequest(t *testing.T, b []byte) []series {
+	t.Helper()
+	var all []series
+	consumeFields(t, b, func(num protowire.Number, typ protowire.Type, v []byte) {
+		if num != 1 || typ != protowire.BytesType {
+			t.Fatalf("unexpected WriteRequest field %d of type %d", num, typ)
+		}
+		ts, _ := protowire.ConsumeBytes(v)
+		var s series
+		samples := 0
+		consumeFields(t, ts, func(num protowire.Number, typ protowire.Type, v []byte) {
+			msg, _ := protowire.ConsumeBytes(v)
+			switch num {
+			case 1:
+				var l label
+				consumeFields(t, msg, func(num protowire.Number, typ protowire.Type, v []byte) {
+					value, _ := protowire.ConsumeString(v)
+					switch num {
+					case 1:
+						l.name = value
+					case 2:
+						l.value = value
+					}
+				})
+				s.labels = append(s.labels, l)
+			case 2:
+				samples++
+				consumeFields(t, msg, func(num protowire.Number, typ protowire.Type, v []byte) {
+					switch num {
+					case 1:
+						bits, _ := protowire.ConsumeFixed64(v)
+						s.value = math.Float64frombits(bits)
+					case 2:
+						ts, _ := protowire.ConsumeVarint(v)
+						s.timestamp = int64(ts)
+					}
+				})
+			default:
+				t.Fatalf("unexpected TimeSeries field %d", num)
+			}
+		})
+		if samples != 1 {
+			t.Errorf("series %v has %d samples, want 1", s, samples)
+		}
+		all = append(all, s)
+	})
+	return all
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, labels, nil)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(constMetrics{
+		prometheus.MustNewConstMetric(desc("oracledb_activity_execute_count", "Executions."), prometheus.CounterValue, 1234),
+		prometheus.MustNewConstMetric(desc("oracledb_sessions_value", "Sessions.", "status", "type"), prometheus.GaugeValue, 3, "ACTIVE", "USER"),
+		// the metric's instance label takes precedence over the external one
+		prometheus.MustNewConstMetric(desc("oracledb_up", "Whether the database is up.", "instance"), prometheus.GaugeValue, 1, "db1"),
+		prometheus.MustNewConstHistogram(desc("oracledb_query_seconds", "Query time.", "sql_id"),
+			5, 12.5, map[float64]uint64{1: 2, 10: 4}, "abc"),
+		prometheus.MustNewConstSummary(desc("oracledb_wait_seconds", "Wait time."),
+			7, 3.5, map[float64]float64{0.5: 0.2, 0.99: 1.5}),
+	})
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	now := time.UnixMilli(1760620455000)
+	external := []label{{"job", "oracledb_exporter"}, {"instance", "exporter-host"}}
+
+	got := map[string]float64{}
+	for _, s := range decodeWriteRequest(t, encodeWriteRequest(mfs, external, now)) {
+		if !sort.SliceIsSorted(s.labels, func(i, j int) bool { return s.labels[i].name < s.labels[j].name }) {
+			t.Errorf("the labels of %v are not sorted by name", s)
+		}
+		if s.labels[0].name != "__name__" {
+			t.Errorf("the first label of %v is %s, want __name__", s, s.labels[0].name)
+		}
+		if s.timestamp != now.UnixMilli() {
+			t.Errorf("the timestamp of %v is %d, want %d", s, s.timestamp, now.UnixMilli())
+		}
+		if _, ok := got[s.String()]; ok {
+			t.Errorf("%v was sent twice", s)
+		}
+		got[s.String()] = s.value
+	}
+
+	want := map[string]float64{
+		`oracledb_activity_execute_count{instance="exporter-host",job="oracledb_exporter"}`:                      1234,
+		`oracledb_sessions_value{instance="exporter-host",job="oracledb_exporter",status="ACTIVE",type="USER"}`:  3,
+		`oracledb_up{instance="db1",job="oracledb_exporter"}`:                                                    1,
+		`oracledb_query_seconds_bucket{instance="exporter-host",job="oracledb_exporter",le="1",sql_id="abc"}`:    2,
+		`oracledb_query_seconds_bucket{instance="exporter-host",job="oracledb_exporter",le="10",sql_id="abc"}`:   4,
+		`oracledb_query_seconds_bucket{instance="exporter-host",job="oracledb_exporter",le="+Inf",sql_id="abc"}`: 5,
+		`oracledb_query_seconds_sum{instance="exporter-host",job="oracledb_exporter",sql_id="abc"}`:              12.5,
+		`oracledb_query_seconds_count{instance="exporter-host",job="oracledb_exporter",sql_id="abc"}`:            5,
+		`oracledb_wait_seconds{instance="exporter-host",job="oracledb_exporter",quantile="0.5"}`:                 0.2,
+		`oracledb_wait_seconds{instance="exporter-host",job="oracledb_exporter",quantile="0.99"}`:                1.5,
+		`oracledb_wait_seconds_sum{instance="exporter-host",job="oracledb_exporter"}`:                            3.5,
+		`oracledb_wait_seconds_count{instance="exporter-host",job="oracledb_exporter"}`:                          7,
+	}
+	for name, value := range want {
+		if v, ok := got[name]; !ok {
+			t.Errorf("%s was not sent", name)
+		} else if v != value {
+			t.Errorf("%s = %v, want %v", name, v, value)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("unexpected series %s", name)
+		}
+	}
+}
+
+func TestWriteWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		maxRetries   int
+		wantErr      bool
+		wantRequests int
+	}{
+		{name: "first attempt", failures: 0, maxRetries: 3, wantRequests: 1},
+		{name: "retried", failures: 2, maxRetries: 3, wantRequests: 3},
+		{name: "retries exhausted", failures: 10, maxRetries: 2, wantErr: true, wantRequests: 3},
+		{name: "no retries", failures: 10, maxRetries: 0, wantErr: true, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1))
+				if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+					t.Errorf("unexpected headers %v", r.Header)
+				}
+				if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+					t.Errorf("basic auth = %q, %q, %v, want user, secret", user, password, ok)
+				}
+				compressed, _ := io.ReadAll(r.Body)
+				body, err := snappy.Decode(nil, compressed)
+				if err != nil {
+					t.Errorf("snappy.Decode: %v", err)
+				} else if got := decodeWriteRequest(t, body); len(got) != 1 || got[0].String() != `oracledb_up{job="oracledb_exporter"}` {
+					t.Errorf("sent %v", got)
+				}
+				if n <= tt.failures {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				}
+			}))
+			defer server.Close()
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(constMetrics{
+				prometheus.MustNewConstMetric(prometheus.NewDesc("oracledb_up", "Whether the database is up.", nil, nil), prometheus.GaugeValue, 1),
+			})
+			w := NewWriter(server.URL, "user", "secret", registry, tt.maxRetries, time.Millisecond,
+				"oracledb", map[string]string{"job": "oracledb_exporter"}, log.NewNopLogger())
+			err := w.WriteWithRetry(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WriteWithRetry() error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if got := int(requests.Load()); got != tt.wantRequests {
+				t.Errorf("%d requests were sent, want %d", got, tt.wantRequests)
+			}
+			if got, want := testutil.ToFloat64(w.failures), float64(min(tt.failures, tt.wantRequests)); got != want {
+				t.Errorf("failures counter = %v, want %v", got, want)
+			}
+		})
+	}
+}
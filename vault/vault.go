@@ -19,9 +19,6 @@ func GetVaultSecret(vaultId string, secretName string) string {
 	promLogConfig := &promlog.Config{}
 	logger := promlog.New(promLogConfig)
 
-	client, err := secrets.NewSecretsClientWithConfigurationProvider(common.DefaultConfigProvider())
-	helpers.FatalIfError(err)
-
 	tenancyID, err := common.DefaultConfigProvider().TenancyOCID()
 	helpers.FatalIfError(err)
 	region, err := common.DefaultConfigProvider().Region()
@@ -29,15 +26,45 @@ func GetVaultSecret(vaultId string, secretName string) string {
 	level.Info(logger).Log("msg", "OCI_VAULT_ID env var is present so using OCI Vault", "Region", region)
 	level.Info(logger).Log("msg", "OCI_VAULT_ID env var is present so using OCI Vault", "tenancyOCID", tenancyID)
 
+	secret, err := getSecret(context.Background(), vaultId, secretName)
+	helpers.FatalIfError(err)
+	return secret
+}
+
+// SecretProvider reads the database password from a secret in OCI Vault. The secret is read every time
+// the password is needed, so a password rotated in the vault is used the next time the exporter connects.
+type SecretProvider struct {
+	vaultID    string
+	secretName string
+}
+
+// NewSecretProvider creates a SecretProvider for the named secret in the vault
+func NewSecretProvider(vaultID, secretName string) *SecretProvider {
+	return &SecretProvider{vaultID: vaultID, secretName: secretName}
+}
+
+// GetPassword reads the current value of the secret
+func (p *SecretProvider) GetPassword(ctx context.Context) (string, error) {
+	return getSecret(ctx, p.vaultID, p.secretName)
+}
+
+func getSecret(ctx context.Context, vaultId string, secretName string) (string, error) {
+	client, err := secrets.NewSecretsClientWithConfigurationProvider(common.DefaultConfigProvider())
+	if err != nil {
+		return "", err
+	}
+
 	req := secrets.GetSecretBundleByNameRequest{
 		SecretName: common.String(secretName),
 		VaultId:    common.String(vaultId)}
 
-	resp, err := client.GetSecretBundleByName(context.Background(), req)
-	helpers.FatalIfError(err)
+	resp, err := client.GetSecretBundleByName(ctx, req)
+	if err != nil {
+		return "", err
+	}
 
 	rawSecret := getSecretFromBase64(resp)
-	return strings.TrimRight(rawSecret, "\r\n") // make sure a \r and/or \n didn't make it into the secret
+	return strings.TrimRight(rawSecret, "\r\n"), nil // make sure a \r and/or \n didn't make it into the secret
 }
 
 func getSecretFromBase64(resp secrets.GetSecretBundleByNameResponse) string {